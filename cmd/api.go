@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	api "github.com/n0h0/git-sandwich/pkg/sandwich"
+)
+
+// The root command validates through the library, so that the library is
+// what the command line tests exercise. Its config and result are converted
+// from and to those of the other commands, which the reporters print.
+
+// apiOptions converts cfg to library options reading from provider.
+func apiOptions(cfg *sandwich.Config, provider *api.Git) api.Options {
+	var rules []api.Rule
+	for _, r := range cfg.Rules {
+		var deny []api.BlockChangeKind
+		for _, kind := range r.DenyBlockChanges {
+			deny = append(deny, api.BlockChangeKind(kind))
+		}
+		rules = append(rules, api.Rule{
+			Name:                     r.Name,
+			StartMarkerRegex:         r.StartMarkerRegex,
+			EndMarkerRegex:           r.EndMarkerRegex,
+			AllowNesting:             r.AllowNesting,
+			AllowBoundaryWithOutside: r.AllowBoundaryWithOutside,
+			Mode:                     api.Mode(r.Mode),
+			DenyBlockChanges:         deny,
+			IncludePatterns:          r.IncludePatterns,
+			ExcludePatterns:          r.ExcludePatterns,
+		})
+	}
+	return api.Options{
+		BaseRef:         cfg.BaseRef,
+		HeadRef:         cfg.HeadRef,
+		Rules:           rules,
+		Paths:           cfg.Paths,
+		IncludePatterns: cfg.IncludePatterns,
+		ExcludePatterns: cfg.ExcludePatterns,
+		ProtectedPaths:  cfg.ProtectedPaths,
+		PerCommit:       cfg.PerCommit,
+		MergePolicy:     api.MergePolicy(cfg.MergePolicy),
+		Snippets:        cfg.Snippets,
+		Jobs:            cfg.Jobs,
+		Diff:            provider,
+		Content:         provider,
+	}
+}
+
+// reportedResult converts a library result for the reporters.
+func reportedResult(r *api.Result) *sandwich.Result {
+	result := &sandwich.Result{Success: r.Success, Commits: r.Commits}
+	if r.Files != nil {
+		result.Files = make([]sandwich.FileResult, 0, len(r.Files))
+	}
+	for _, fr := range r.Files {
+		result.Files = append(result.Files, reportedFileResult(fr))
+	}
+	return result
+}
+
+func reportedFileResult(fr api.FileResult) sandwich.FileResult {
+	result := sandwich.FileResult{
+		Path:            fr.Path,
+		OldPath:         fr.OldPath,
+		Commit:          fr.Commit,
+		Rule:            fr.Rule,
+		Mode:            sandwich.Mode(fr.Mode),
+		Success:         fr.Success,
+		OutsideBase:     reportedLineRanges(fr.OutsideBase),
+		OutsideHead:     reportedLineRanges(fr.OutsideHead),
+		ProtectedBase:   reportedLineRanges(fr.ProtectedBase),
+		ProtectedHead:   reportedLineRanges(fr.ProtectedHead),
+		BoundaryChanged: fr.BoundaryChanged,
+		PolicyError:     fr.PolicyError,
+		SkipReason:      fr.SkipReason,
+	}
+	for _, c := range fr.BlockChanges {
+		result.BlockChanges = append(result.BlockChanges, sandwich.BlockChange{
+			Kind:    sandwich.BlockChangeKind(c.Kind),
+			Name:    c.Name,
+			OldName: c.OldName,
+			Base:    reportedLineRange(c.Base),
+			Head:    reportedLineRange(c.Head),
+			Denied:  c.Denied,
+		})
+	}
+	for _, e := range fr.BlockErrors {
+		result.BlockErrors = append(result.BlockErrors, sandwich.BlockError{
+			Kind:      sandwich.BlockErrorKind(e.Kind),
+			Side:      e.Side,
+			Line:      e.Line,
+			Name:      e.Name,
+			BeginName: e.BeginName,
+			BeginLine: e.BeginLine,
+			Message:   e.Message,
+		})
+	}
+	for _, s := range fr.Snippets {
+		var snippet sandwich.Snippet
+		if s.Lines != nil {
+			snippet.Lines = make([]sandwich.SnippetLine, 0, len(s.Lines))
+		}
+		for _, l := range s.Lines {
+			snippet.Lines = append(snippet.Lines, sandwich.SnippetLine(l))
+		}
+		result.Snippets = append(result.Snippets, snippet)
+	}
+	for _, b := range fr.RangeBlocks {
+		result.RangeBlocks = append(result.RangeBlocks, sandwich.RangeBlock{Side: b.Side, Lines: diff.LineRange(b.Lines), Name: b.Name})
+	}
+	for _, h := range fr.Hunks {
+		result.Hunks = append(result.Hunks, diff.Hunk(h))
+	}
+	return result
+}
+
+func reportedLineRanges(ranges []api.LineRange) []diff.LineRange {
+	var result []diff.LineRange
+	for _, r := range ranges {
+		result = append(result, diff.LineRange(r))
+	}
+	return result
+}
+
+func reportedLineRange(r *api.LineRange) *diff.LineRange {
+	if r == nil {
+		return nil
+	}
+	lr := diff.LineRange(*r)
+	return &lr
+}
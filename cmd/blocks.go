@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/output"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	"github.com/spf13/cobra"
+)
+
+var blocksRef string
+
+var blocksCmd = &cobra.Command{
+	Use:   "blocks",
+	Short: "List every block in the tracked files",
+	Long: `blocks parses every tracked file that passes the --include/--exclude
+filters and lists its blocks with their name, marker lines and size.
+
+Files with invalid markers are listed as errors, and the exit code is 1.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeRepository()
+		if err := mergeConfig(cmd, nil); err != nil {
+			return err
+		}
+
+		cfg, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+		cfg.HeadRef = git.WorktreeRef
+		if blocksRef != "" {
+			cfg.HeadRef = blocksRef
+		}
+
+		inv, err := sandwich.ListBlocks(cmd.Context(), cfg)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case jsonOutput || outputFormat == "json":
+			if err := output.FormatInventoryJSON(os.Stdout, inv); err != nil {
+				return err
+			}
+		case outputFormat == "text":
+			output.FormatInventory(os.Stdout, inv)
+		default:
+			return fmt.Errorf("invalid --format value %q (blocks supports text and json)", outputFormat)
+		}
+
+		if len(inv.Errors) > 0 {
+			return failed(cmd)
+		}
+		return nil
+	},
+}
+
+func init() {
+	blocksCmd.Flags().StringVar(&blocksRef, "ref", "", "ref to read the files from (default: the working tree)")
+	rootCmd.AddCommand(blocksCmd)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	"github.com/spf13/cobra"
+)
+
+var (
+	templateDir string
+	driftRef    string
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Check that regions outside blocks still match a template",
+	Long: `drift compares every file in --template-dir with the file at the same
+path in the repository. Block contents are ignored on both sides, so only
+changes outside blocks are reported as drift.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeRepository()
+		if err := mergeConfig(cmd, nil); err != nil {
+			return err
+		}
+
+		cfg, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+		reporter, err := newReporter()
+		if err != nil {
+			return err
+		}
+		cfg.HeadRef = git.WorktreeRef
+		if driftRef != "" {
+			cfg.HeadRef = driftRef
+		}
+
+		result, err := sandwich.CheckDrift(cmd.Context(), cfg, templateDir)
+		if err != nil {
+			return err
+		}
+		return writeResult(cmd, reporter, result)
+	},
+}
+
+func init() {
+	driftCmd.Flags().StringVar(&templateDir, "template-dir", "", "directory containing the template files")
+	driftCmd.Flags().StringVar(&driftRef, "ref", "", "ref to read the files from (default: the working tree)")
+	driftCmd.MarkFlagRequired("template-dir")
+	rootCmd.AddCommand(driftCmd)
+}
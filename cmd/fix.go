@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/output"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	"github.com/spf13/cobra"
+)
+
+var fixPatch bool
+
+var fixCmd = &cobra.Command{
+	Use:   "fix [paths...]",
+	Short: "Revert working tree changes that are outside blocks",
+	Long: `fix restores every changed line in the working tree that fails
+validation to its content at the merge base of --base and HEAD. Changes
+the rule allows are kept: those inside blocks, or in protect mode those
+outside blocks.
+
+Files whose block boundaries changed, files in protect mode where a reverted
+change touches allowed lines, and files that fail for other reasons such as
+invalid markers are not touched and are reported instead.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeRepository()
+		if err := mergeConfig(cmd, baseTrusted(cmd)); err != nil {
+			return err
+		}
+
+		cfg, err := buildConfig(args)
+		if err != nil {
+			return err
+		}
+		cfg.HeadRef = git.WorktreeRef
+		// The diff is taken from the merge base, so the base content must be too
+		cfg.BaseRef, err = cfg.Repo().MergeBase(cmd.Context(), baseRef, "HEAD")
+		if err != nil {
+			return fmt.Errorf("finding merge base of %s and HEAD: %w", baseRef, err)
+		}
+
+		result, err := sandwich.Fix(cmd.Context(), cfg)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range result.Files {
+			if fixPatch {
+				oldName := "a/" + f.Path
+				if f.Deleted {
+					oldName = "/dev/null"
+				}
+				fmt.Fprint(os.Stdout, diff.Unified(oldName, "b/"+f.Path, f.Original, f.Content, 3))
+				continue
+			}
+			path, err := cfg.Repo().WorktreePath(cmd.Context(), f.Path)
+			if err != nil {
+				return err
+			}
+			// Deleted files are restored, possibly with their directory
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return fmt.Errorf("writing %s: %w", f.Path, err)
+			}
+			if err := os.WriteFile(path, []byte(f.Content), 0o644); err != nil {
+				return fmt.Errorf("writing %s: %w", f.Path, err)
+			}
+			fmt.Fprintf(os.Stdout, "fixed %s\n", f.Path)
+		}
+
+		if len(result.Refused) > 0 {
+			output.FormatFixRefusals(os.Stderr, result.Refused)
+			return failed(cmd)
+		}
+		return nil
+	},
+}
+
+func init() {
+	fixCmd.Flags().StringVar(&baseRef, "base", "origin/main", "base ref to restore lines from")
+	fixCmd.Flags().BoolVar(&fixPatch, "patch", false, "print the reverting patch instead of writing files")
+	rootCmd.AddCommand(fixCmd)
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/hook"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Run as a server-side Git hook",
+}
+
+var preReceiveCmd = &cobra.Command{
+	Use:   "pre-receive",
+	Short: "Validate every ref update read from stdin",
+	Long: `pre-receive reads "<old> <new> <ref>" lines from stdin, as passed to a
+pre-receive hook, and validates each update. The push is rejected if any
+update fails.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		updates, err := hook.ParseUpdates(os.Stdin)
+		if err != nil {
+			return err
+		}
+		return runHook(cmd, updates)
+	},
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update <ref> <old> <new>",
+	Short: "Validate a single ref update",
+	Long: `update validates one ref update using the arguments passed to an
+update hook. Only that ref is rejected if validation fails.`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		updates := []hook.Update{{RefName: args[0], OldRev: args[1], NewRev: args[2]}}
+		return runHook(cmd, updates)
+	},
+}
+
+func runHook(cmd *cobra.Command, updates []hook.Update) error {
+	defer closeRepository()
+	// Hooks see the pushed objects only through the environment git sets
+	if gitBackend == git.BackendGoGit {
+		return git.ErrObjectDirectory
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	// Each update is validated against the config of its own base
+	config := func(base string) (*sandwich.Config, error) {
+		resetFlags(cmd)
+		if err := mergeConfig(cmd, func(string) string { return base }); err != nil {
+			return nil, err
+		}
+		if gitBackend == git.BackendGoGit {
+			return nil, git.ErrObjectDirectory
+		}
+		return buildConfig(nil)
+	}
+	results := hook.Check(cmd.Context(), repo, config, updates)
+	hook.Report(os.Stdout, results)
+
+	for _, rr := range results {
+		if !rr.Success() {
+			return failed(cmd)
+		}
+	}
+	return nil
+}
+
+// resetFlags sets the flags not given on the command line back to their
+// defaults, undoing what mergeConfig set from a config file.
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			v.Replace(nil)
+			return
+		}
+		f.Value.Set(f.DefValue)
+	})
+	fileRules = nil
+	protectedPaths = nil
+}
+
+func init() {
+	hookCmd.AddCommand(preReceiveCmd)
+	hookCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(hookCmd)
+}
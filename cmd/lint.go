@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	"github.com/spf13/cobra"
+)
+
+var lintRef string
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check the block structure of every tracked file",
+	Long: `lint checks that the BEGIN/END markers of every tracked file that passes
+the --include/--exclude filters are well-formed, whether or not the file
+changed. All errors of a file are reported, and the exit code is 1 if any
+are found.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeRepository()
+		if err := mergeConfig(cmd, nil); err != nil {
+			return err
+		}
+
+		cfg, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+		cfg.HeadRef = git.WorktreeRef
+		if lintRef != "" {
+			cfg.HeadRef = lintRef
+		}
+		reporter, err := newReporter()
+		if err != nil {
+			return err
+		}
+
+		result, err := sandwich.Lint(cmd.Context(), cfg)
+		if err != nil {
+			return err
+		}
+		return writeResult(cmd, reporter, result)
+	},
+}
+
+func init() {
+	lintCmd.Flags().StringVar(&lintRef, "ref", "", "ref to read the files from (default: the working tree)")
+	rootCmd.AddCommand(lintCmd)
+}
@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/n0h0/git-sandwich/internal/config"
+	"github.com/n0h0/git-sandwich/internal/git"
 	"github.com/n0h0/git-sandwich/internal/output"
 	"github.com/n0h0/git-sandwich/internal/sandwich"
+	api "github.com/n0h0/git-sandwich/pkg/sandwich"
 	"github.com/spf13/cobra"
 )
 
@@ -19,85 +27,439 @@ var (
 	allowNesting             bool
 	allowBoundaryWithOutside bool
 	jsonOutput               bool
+	outputFormat             string
+	templateFile             string
+	verbose                  bool
+	markdownMaxLength        int
 	includePatterns          []string
 	excludePatterns          []string
 	configPath               string
+	staged                   bool
+	perCommit                bool
+	blockMode                string
+	denyBlockChanges         []string
+	trustedConfigRef         string
+	protectedPaths           []string
+	fileRules                []config.Rule
+	mergePolicy              string
+	worktree                 bool
+	gitBackend               string
+	jobs                     int
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "git-sandwich [paths...]",
+	Args:  cobra.ArbitraryArgs,
 	Short: "Validate that changes are within BEGIN/END sandwich blocks",
 	Long: `git-sandwich verifies that all changes in a Git diff are within
 designated BEGIN/END blocks. Changes outside these blocks are rejected.`,
+	// Usage is printed for invalid flags and arguments only, not for the
+	// errors of a command that is already running
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := mergeConfig(cmd); err != nil {
+		defer closeRepository()
+		if err := mergeConfig(cmd, baseTrusted(cmd)); err != nil {
 			return err
 		}
 
-		startRe, err := regexp.Compile(startMarker)
+		if staged {
+			headRef = git.StagedRef
+		} else if worktree {
+			headRef = git.WorktreeRef
+		}
+
+		cfg, err := buildConfig(args)
 		if err != nil {
-			return fmt.Errorf("invalid --start regex: %w", err)
+			return err
 		}
-		endRe, err := regexp.Compile(endMarker)
+		reporter, err := newReporter()
 		if err != nil {
-			return fmt.Errorf("invalid --end regex: %w", err)
+			return err
 		}
 
-		cfg := &sandwich.Config{
-			StartMarkerRegex:         startRe,
-			EndMarkerRegex:           endRe,
-			BaseRef:                  baseRef,
-			HeadRef:                  headRef,
-			AllowNesting:             allowNesting,
-			AllowBoundaryWithOutside: allowBoundaryWithOutside,
-			Paths:                    args,
-			IncludePatterns:          includePatterns,
-			ExcludePatterns:          excludePatterns,
+		// The library reads through a repository of its own
+		closeRepository()
+		provider, err := api.NewGit(gitBackend)
+		if err != nil {
+			return fmt.Errorf("invalid --git-backend: %w", err)
 		}
+		defer provider.Close()
 
-		result, err := sandwich.Validate(cfg)
+		result, err := api.Validate(cmd.Context(), apiOptions(cfg, provider))
 		if err != nil {
 			return err
 		}
 
-		if jsonOutput {
-			if err := output.FormatJSON(os.Stdout, result); err != nil {
-				return err
-			}
-		} else {
-			output.FormatText(os.Stdout, result)
+		return writeResult(cmd, reporter, reportedResult(result))
+	},
+}
+
+// reportFormat returns the format selected by --format, with --json taking
+// precedence for compatibility.
+func reportFormat() string {
+	if jsonOutput {
+		return "json"
+	}
+	return outputFormat
+}
+
+// newReporter creates the reporter selected by reportFormat.
+func newReporter() (output.Reporter, error) {
+	reporter, err := output.NewReporter(reportFormat(), output.Options{
+		TemplateFile:      templateFile,
+		Verbose:           verbose,
+		Color:             useColor(),
+		MarkdownMaxLength: markdownMaxLength,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format: %w", err)
+	}
+	return reporter, nil
+}
+
+// useColor reports whether the output should be coloured: only when stdout
+// is a terminal and NO_COLOR (https://no-color.org) is not set.
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeResult prints the result with the reporter and fails the command if
+// validation failed.
+func writeResult(cmd *cobra.Command, reporter output.Reporter, result *sandwich.Result) error {
+	if err := reporter.Report(os.Stdout, result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return failed(cmd)
+	}
+	return nil
+}
+
+// errFailed is returned by commands that have already reported why they
+// failed. It makes the program exit with status 1, after the deferred
+// cleanup of the command has run, without printing anything more.
+var errFailed = errors.New("failed")
+
+// failed returns errFailed, silencing cobra's error and usage output for cmd.
+func failed(cmd *cobra.Command) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return errFailed
+}
+
+// loadConfig loads the config file, returning nil if there is none.
+//
+// An explicit --config path is read from disk and must exist. Otherwise the
+// config is read from the trusted ref, if there is one, so that a change
+// cannot relax the rules it is validated against. The config path is then
+// protected: any change to it is reported as a policy violation. If the
+// trusted ref has no config, the file in the current directory is used if it
+// exists.
+//
+// The trusted ref is --trusted-config-from, or else the ref trusted returns
+// for the base named by the config (or "" if it names none), so that the
+// config is read from the base the changes are validated against. Commands
+// that validate no diff pass a nil trusted and read the config from disk
+// unless --trusted-config-from is given.
+func loadConfig(cmd *cobra.Command, trusted func(configBase string) string) (*config.FileConfig, error) {
+	if cmd.Flags().Changed("config") {
+		// --config was explicitly specified: file must exist
+		return config.Load(configPath)
+	}
+	if filepath.IsAbs(configPath) || (trustedConfigRef == "" && trusted == nil) {
+		return loadLocalConfig()
+	}
+
+	repo, err := openRepository()
+	if err != nil {
+		return nil, err
+	}
+	repoPath, err := repo.RepoPath(cmd.Context(), configPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolving config path: %w", err)
+	}
+	protectedPaths = []string{repoPath}
+	if trustedConfigRef != "" {
+		fileCfg, err := readConfig(cmd, repo, trustedConfigRef, repoPath)
+		if fileCfg != nil || err != nil {
+			return fileCfg, err
+		}
+		return loadLocalConfig()
+	}
+
+	// The default base may not exist when the config names another one
+	ref := trusted("")
+	fileCfg, refErr := readConfig(cmd, repo, ref, repoPath)
+	if refErr != nil && cmd.Flags().Changed("base") {
+		return nil, refErr
+	}
+	if fileCfg == nil {
+		if fileCfg, err = loadLocalConfig(); err != nil {
+			return nil, err
 		}
+	}
+	configBase := ""
+	if fileCfg != nil {
+		configBase = fileCfg.Base
+	}
+	next := trusted(configBase)
+	if next == ref {
+		return fileCfg, refErr
+	}
+	baseCfg, err := readConfig(cmd, repo, next, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if baseCfg == nil {
+		return fileCfg, nil
+	}
+	if baseCfg.Base != "" && trusted(baseCfg.Base) != next {
+		return nil, fmt.Errorf("config at %s sets base %s", next, baseCfg.Base)
+	}
+	// The config is validated against the base it was read from
+	baseCfg.Base = next
+	return baseCfg, nil
+}
 
-		if !result.Success {
-			os.Exit(1)
+// readConfig reads the config file at a ref, returning nil if there is none.
+func readConfig(cmd *cobra.Command, repo git.Repository, ref, path string) (*config.FileConfig, error) {
+	content, exists, err := repo.GetFileContent(cmd.Context(), ref, path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config from %s: %w", ref, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	return config.Parse([]byte(content))
+}
+
+// loadLocalConfig loads the config file from disk, returning nil if there is
+// none.
+func loadLocalConfig() (*config.FileConfig, error) {
+	if _, err := os.Stat(configPath); err == nil {
+		return config.Load(configPath)
+	}
+	return nil, nil
+}
+
+// baseTrusted returns the trusted func of loadConfig for commands that
+// validate the changes since the base ref: --base if given, or else the base
+// the config names, or else the default.
+func baseTrusted(cmd *cobra.Command) func(string) string {
+	return func(configBase string) string {
+		if configBase == "" || cmd.Flags().Changed("base") {
+			return baseRef
 		}
-		return nil
-	},
+		return configBase
+	}
 }
 
-func mergeConfig(cmd *cobra.Command) error {
-	var fileCfg *config.FileConfig
+// The repositories opened by openRepository, by backend.
+var openRepos = make(map[string]git.Repository)
+
+// openRepository returns the repository accessed through the backend selected
+// by --git-backend. The trusted config is read before the config file can
+// select another backend, and in hooks every update has a config of its own,
+// so one repository is kept open per backend until closeRepository.
+func openRepository() (git.Repository, error) {
+	if repo, ok := openRepos[gitBackend]; ok {
+		return repo, nil
+	}
+	repo, err := git.Open(gitBackend)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --git-backend: %w", err)
+	}
+	openRepos[gitBackend] = repo
+	return repo, nil
+}
 
-	configExplicit := cmd.Flags().Changed("config")
+// closeRepository closes the repositories opened by openRepository. Every
+// command defers it before it loads its config.
+func closeRepository() {
+	for _, repo := range openRepos {
+		if c, ok := repo.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	clear(openRepos)
+}
 
-	if configExplicit {
-		// --config was explicitly specified: file must exist
-		cfg, err := config.Load(configPath)
+// buildConfig compiles the marker regexes, checks the flag values and
+// assembles the config every command runs with. The --start and --end
+// markers become an unnamed rule ahead of the named rules.
+func buildConfig(paths []string) (*sandwich.Config, error) {
+	var startRe, endRe *regexp.Regexp
+	if startMarker != "" {
+		var err error
+		startRe, err = regexp.Compile(startMarker)
 		if err != nil {
-			return fmt.Errorf("loading config: %w", err)
+			return nil, fmt.Errorf("invalid --start regex: %w", err)
 		}
-		fileCfg = cfg
-	} else {
-		// Default path: load if exists, skip otherwise
-		if _, err := os.Stat(configPath); err == nil {
-			cfg, err := config.Load(configPath)
-			if err != nil {
-				return fmt.Errorf("loading config: %w", err)
-			}
-			fileCfg = cfg
+		endRe, err = regexp.Compile(endMarker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --end regex: %w", err)
 		}
 	}
 
+	mode, err := parseMode(blockMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --mode: %w", err)
+	}
+
+	deny, err := parseBlockChangeKinds(denyBlockChanges)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --deny-block-change: %w", err)
+	}
+
+	rules, err := buildRules(fileRules)
+	if err != nil {
+		return nil, err
+	}
+
+	merges := sandwich.MergePolicy(mergePolicy)
+	switch merges {
+	case sandwich.MergeSkip, sandwich.MergeFirstParent, sandwich.MergeAllParents:
+	default:
+		return nil, fmt.Errorf("invalid --merges value %q (want skip, first-parent or all-parents)", mergePolicy)
+	}
+
+	if jobs < 0 {
+		return nil, fmt.Errorf("invalid --jobs value %d (want 0 or more)", jobs)
+	}
+
+	if startRe != nil {
+		rules = append([]sandwich.Rule{{
+			StartMarkerRegex:         startRe,
+			EndMarkerRegex:           endRe,
+			AllowNesting:             allowNesting,
+			AllowBoundaryWithOutside: allowBoundaryWithOutside,
+			Mode:                     mode,
+			DenyBlockChanges:         deny,
+		}}, rules...)
+	}
+
+	repo, err := openRepository()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sandwich.Config{
+		BaseRef:         baseRef,
+		HeadRef:         headRef,
+		Paths:           paths,
+		IncludePatterns: includePatterns,
+		ExcludePatterns: excludePatterns,
+		PerCommit:       perCommit,
+		MergePolicy:     merges,
+		ProtectedPaths:  protectedPaths,
+		Rules:           rules,
+		Snippets:        verbose || reportFormat() == "markdown",
+		Jobs:            jobs,
+		Repository:      repo,
+	}, nil
+}
+
+// buildRules compiles the named rules from the config file. Flags a rule
+// leaves unset inherit the top-level values.
+func buildRules(ruleCfgs []config.Rule) ([]sandwich.Rule, error) {
+	var rules []sandwich.Rule
+	seen := make(map[string]bool)
+	for i, rc := range ruleCfgs {
+		if rc.Name == "" {
+			return nil, fmt.Errorf("rules[%d]: name is required", i)
+		}
+		if seen[rc.Name] {
+			return nil, fmt.Errorf("rule %q: duplicate name", rc.Name)
+		}
+		seen[rc.Name] = true
+
+		if rc.Start == "" || rc.End == "" {
+			return nil, fmt.Errorf("rule %q: start and end are required", rc.Name)
+		}
+		startRe, err := regexp.Compile(rc.Start)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid start regex: %w", rc.Name, err)
+		}
+		endRe, err := regexp.Compile(rc.End)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid end regex: %w", rc.Name, err)
+		}
+
+		mode, err := parseMode(rc.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rc.Name, err)
+		}
+
+		denyKinds := denyBlockChanges
+		if rc.DenyBlockChanges != nil {
+			denyKinds = rc.DenyBlockChanges
+		}
+		deny, err := parseBlockChangeKinds(denyKinds)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rc.Name, err)
+		}
+
+		rule := sandwich.Rule{
+			Name:                     rc.Name,
+			StartMarkerRegex:         startRe,
+			EndMarkerRegex:           endRe,
+			AllowNesting:             allowNesting,
+			AllowBoundaryWithOutside: allowBoundaryWithOutside,
+			Mode:                     mode,
+			DenyBlockChanges:         deny,
+			IncludePatterns:          rc.Include,
+			ExcludePatterns:          rc.Exclude,
+		}
+		if rc.AllowNesting != nil {
+			rule.AllowNesting = *rc.AllowNesting
+		}
+		if rc.AllowBoundaryWithOutside != nil {
+			rule.AllowBoundaryWithOutside = *rc.AllowBoundaryWithOutside
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseMode converts a mode name to a sandwich.Mode. An empty name is allow.
+func parseMode(s string) (sandwich.Mode, error) {
+	switch mode := sandwich.Mode(s); mode {
+	case "", sandwich.ModeAllow:
+		return sandwich.ModeAllow, nil
+	case sandwich.ModeProtect:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown mode %q (want allow or protect)", s)
+}
+
+// parseBlockChangeKinds converts block change kind names to sandwich values.
+func parseBlockChangeKinds(names []string) ([]sandwich.BlockChangeKind, error) {
+	var kinds []sandwich.BlockChangeKind
+	for _, name := range names {
+		switch kind := sandwich.BlockChangeKind(name); kind {
+		case sandwich.BlockAdded, sandwich.BlockDeleted, sandwich.BlockRenamed, sandwich.BlockMoved, sandwich.BlockResized:
+			kinds = append(kinds, kind)
+		default:
+			return nil, fmt.Errorf("unknown block change %q (want added, deleted, renamed, moved or resized)", name)
+		}
+	}
+	return kinds, nil
+}
+
+// mergeConfig loads the config file with loadConfig and sets the flags not
+// given on the command line from it.
+func mergeConfig(cmd *cobra.Command, trusted func(configBase string) string) error {
+	fileCfg, err := loadConfig(cmd, trusted)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
 	if fileCfg != nil {
 		if !cmd.Flags().Changed("start") && fileCfg.Start != "" {
 			startMarker = fileCfg.Start
@@ -117,21 +479,53 @@ func mergeConfig(cmd *cobra.Command) error {
 		if !cmd.Flags().Changed("allow-boundary-with-outside") && fileCfg.AllowBoundaryWithOutside {
 			allowBoundaryWithOutside = fileCfg.AllowBoundaryWithOutside
 		}
+		if !cmd.Flags().Changed("mode") && fileCfg.Mode != "" {
+			blockMode = fileCfg.Mode
+		}
+		if !cmd.Flags().Changed("deny-block-change") && len(fileCfg.DenyBlockChanges) > 0 {
+			denyBlockChanges = fileCfg.DenyBlockChanges
+		}
 		if !cmd.Flags().Changed("json") && fileCfg.JSON {
 			jsonOutput = fileCfg.JSON
 		}
+		if !cmd.Flags().Changed("format") && fileCfg.Format != "" {
+			outputFormat = fileCfg.Format
+		}
+		if !cmd.Flags().Changed("template-file") && fileCfg.TemplateFile != "" {
+			templateFile = fileCfg.TemplateFile
+		}
+		if !cmd.Flags().Changed("verbose") && fileCfg.Verbose {
+			verbose = fileCfg.Verbose
+		}
+		if !cmd.Flags().Changed("markdown-max-length") && fileCfg.MarkdownMaxLength != 0 {
+			markdownMaxLength = fileCfg.MarkdownMaxLength
+		}
 		if !cmd.Flags().Changed("include") && len(fileCfg.Include) > 0 {
 			includePatterns = fileCfg.Include
 		}
 		if !cmd.Flags().Changed("exclude") && len(fileCfg.Exclude) > 0 {
 			excludePatterns = fileCfg.Exclude
 		}
+		if !cmd.Flags().Changed("per-commit") && fileCfg.PerCommit {
+			perCommit = fileCfg.PerCommit
+		}
+		if !cmd.Flags().Changed("merges") && fileCfg.Merges != "" {
+			mergePolicy = fileCfg.Merges
+		}
+		if !cmd.Flags().Changed("git-backend") && fileCfg.GitBackend != "" {
+			gitBackend = fileCfg.GitBackend
+		}
+		if !cmd.Flags().Changed("jobs") && fileCfg.Jobs != 0 {
+			jobs = fileCfg.Jobs
+		}
+		fileRules = fileCfg.Rules
 	}
 
-	if startMarker == "" {
+	// start/end may be omitted only when the config file declares named rules
+	if startMarker == "" && (endMarker != "" || len(fileRules) == 0) {
 		return fmt.Errorf(`required flag "start" not set`)
 	}
-	if endMarker == "" {
+	if endMarker == "" && (startMarker != "" || len(fileRules) == 0) {
 		return fmt.Errorf(`required flag "end" not set`)
 	}
 
@@ -142,21 +536,39 @@ func SetVersion(v, c, d string) {
 	rootCmd.Version = fmt.Sprintf("%s (commit: %s, built: %s)", v, c, d)
 }
 
+// Execute runs the command line. An interrupt cancels the validation in
+// progress.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		os.Exit(1)
 	}
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&startMarker, "start", "", "BEGIN marker regex")
-	rootCmd.Flags().StringVar(&endMarker, "end", "", "END marker regex")
+	rootCmd.PersistentFlags().StringVar(&startMarker, "start", "", "BEGIN marker regex")
+	rootCmd.PersistentFlags().StringVar(&endMarker, "end", "", "END marker regex")
 	rootCmd.Flags().StringVar(&baseRef, "base", "origin/main", "base ref for comparison")
 	rootCmd.Flags().StringVar(&headRef, "head", "HEAD", "head ref for comparison")
-	rootCmd.Flags().BoolVar(&allowNesting, "allow-nesting", false, "allow nested blocks")
-	rootCmd.Flags().BoolVar(&allowBoundaryWithOutside, "allow-boundary-with-outside", false, "allow boundary changes with outside changes")
-	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "output in JSON format")
-	rootCmd.Flags().StringArrayVar(&includePatterns, "include", nil, "glob pattern for files to include (repeatable)")
-	rootCmd.Flags().StringArrayVar(&excludePatterns, "exclude", nil, "glob pattern for files to exclude (repeatable)")
-	rootCmd.Flags().StringVar(&configPath, "config", ".git-sandwich.yml", "path to config file")
+	rootCmd.PersistentFlags().BoolVar(&allowNesting, "allow-nesting", false, "allow nested blocks")
+	rootCmd.PersistentFlags().BoolVar(&allowBoundaryWithOutside, "allow-boundary-with-outside", false, "allow boundary changes with outside changes")
+	rootCmd.PersistentFlags().StringVar(&blockMode, "mode", string(sandwich.ModeAllow), "block mode: allow (edits only inside blocks) or protect (no edits inside blocks)")
+	rootCmd.PersistentFlags().StringArrayVar(&denyBlockChanges, "deny-block-change", nil, "reject a kind of block change: added, deleted, renamed, moved or resized (repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in JSON format (same as --format json)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "format", "text", "output format: "+strings.Join(output.Formats(), ", "))
+	rootCmd.PersistentFlags().StringVar(&templateFile, "template-file", "", "text/template file for --format template")
+	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "show the offending lines of each failed file")
+	rootCmd.PersistentFlags().IntVar(&markdownMaxLength, "markdown-max-length", output.DefaultMarkdownLimit, "maximum length in characters of --format markdown")
+	rootCmd.PersistentFlags().StringArrayVar(&includePatterns, "include", nil, "glob pattern for files to include (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&excludePatterns, "exclude", nil, "glob pattern for files to exclude (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", ".git-sandwich.yml", "path to config file")
+	rootCmd.PersistentFlags().BoolVar(&perCommit, "per-commit", false, "validate each commit in base..head against its parent")
+	rootCmd.PersistentFlags().StringVar(&mergePolicy, "merges", string(sandwich.MergeSkip), "merge commits in per-commit mode: skip, first-parent or all-parents")
+	rootCmd.PersistentFlags().StringVar(&trustedConfigRef, "trusted-config-from", "", "ref to read the config file from (default: the base ref, or the working tree for commands without one)")
+	rootCmd.Flags().BoolVar(&staged, "staged", false, "validate staged changes instead of the head ref")
+	rootCmd.Flags().BoolVar(&worktree, "worktree", false, "validate working tree changes instead of the head ref")
+	rootCmd.PersistentFlags().StringVar(&gitBackend, "git-backend", git.BackendExec, "repository backend: exec (run git per file), batch (one git cat-file process) or go-git (in process)")
+	rootCmd.PersistentFlags().IntVar(&jobs, "jobs", 0, "number of files to validate in parallel (0: one per CPU)")
+	rootCmd.MarkFlagsMutuallyExclusive("staged", "worktree", "head")
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/output"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+	"github.com/spf13/cobra"
+)
+
+var syncDryRun bool
+
+var syncCmd = &cobra.Command{
+	Use:   "sync <template> <target>",
+	Short: "Re-apply a template while keeping the target's block contents",
+	Long: `sync copies the contents of each block in <target> into the matching
+block of <template> and writes the result to <target>. Blocks are matched by
+name, or by order for unnamed blocks.
+
+Blocks in <target> that no longer exist in <template> are reported as
+conflicts, and <target> is left unchanged.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		templatePath, targetPath := args[0], args[1]
+
+		defer closeRepository()
+		if err := mergeConfig(cmd, nil); err != nil {
+			return err
+		}
+
+		cfg, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+
+		template, err := os.ReadFile(templatePath)
+		if err != nil {
+			return fmt.Errorf("reading template: %w", err)
+		}
+		target, err := os.ReadFile(targetPath)
+		if err != nil {
+			return fmt.Errorf("reading target: %w", err)
+		}
+
+		// Rules match repository-relative paths
+		rulePath, err := cfg.Repo().RepoPath(cmd.Context(), targetPath)
+		if err != nil {
+			rulePath = targetPath
+		}
+
+		result, err := sandwich.Sync(cfg, rulePath, string(template), string(target))
+		if err != nil {
+			return err
+		}
+
+		if syncDryRun {
+			fmt.Fprint(os.Stdout, diff.Unified("a/"+rulePath, "b/"+rulePath, string(target), result.Content, 3))
+		}
+
+		if len(result.Conflicts) > 0 {
+			output.FormatSyncConflicts(os.Stderr, targetPath, result.Conflicts)
+			return failed(cmd)
+		}
+
+		if !syncDryRun {
+			if err := os.WriteFile(targetPath, []byte(result.Content), 0o644); err != nil {
+				return fmt.Errorf("writing target: %w", err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "print a diff instead of writing the target")
+	rootCmd.AddCommand(syncCmd)
+}
@@ -14,7 +14,32 @@ type FileConfig struct {
 	Head                     string   `yaml:"head"`
 	AllowNesting             bool     `yaml:"allow_nesting"`
 	AllowBoundaryWithOutside bool     `yaml:"allow_boundary_with_outside"`
+	Mode                     string   `yaml:"mode"`
+	DenyBlockChanges         []string `yaml:"deny_block_changes"`
 	JSON                     bool     `yaml:"json"`
+	Format                   string   `yaml:"format"`
+	TemplateFile             string   `yaml:"template_file"`
+	Verbose                  bool     `yaml:"verbose"`
+	MarkdownMaxLength        int      `yaml:"markdown_max_length"`
+	Include                  []string `yaml:"include"`
+	Exclude                  []string `yaml:"exclude"`
+	PerCommit                bool     `yaml:"per_commit"`
+	Merges                   string   `yaml:"merges"`
+	GitBackend               string   `yaml:"git_backend"`
+	Jobs                     int      `yaml:"jobs"`
+	Rules                    []Rule   `yaml:"rules"`
+}
+
+// Rule is a named set of block markers. Flags left unset inherit the
+// top-level values; Mode does not and defaults to "allow".
+type Rule struct {
+	Name                     string   `yaml:"name"`
+	Start                    string   `yaml:"start"`
+	End                      string   `yaml:"end"`
+	AllowNesting             *bool    `yaml:"allow_nesting"`
+	AllowBoundaryWithOutside *bool    `yaml:"allow_boundary_with_outside"`
+	Mode                     string   `yaml:"mode"`
+	DenyBlockChanges         []string `yaml:"deny_block_changes"`
 	Include                  []string `yaml:"include"`
 	Exclude                  []string `yaml:"exclude"`
 }
@@ -25,6 +50,11 @@ func Load(path string) (*FileConfig, error) {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
 
+	return Parse(data)
+}
+
+// Parse parses config file contents, e.g. as read from a git ref.
+func Parse(data []byte) (*FileConfig, error) {
 	var cfg FileConfig
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
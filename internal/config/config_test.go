@@ -21,6 +21,8 @@ include:
   - "*.rb"
 exclude:
   - "vendor/**"
+per_commit: true
+merges: "first-parent"
 `
 	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 		t.Fatal(err)
@@ -58,6 +60,12 @@ exclude:
 	if len(cfg.Exclude) != 1 || cfg.Exclude[0] != "vendor/**" {
 		t.Errorf("Exclude = %v, want [vendor/**]", cfg.Exclude)
 	}
+	if !cfg.PerCommit {
+		t.Error("PerCommit = false, want true")
+	}
+	if cfg.Merges != "first-parent" {
+		t.Errorf("Merges = %q, want %q", cfg.Merges, "first-parent")
+	}
 }
 
 func TestLoad_PartialFields(t *testing.T) {
@@ -142,3 +150,64 @@ func TestLoad_FileNotFound(t *testing.T) {
 		t.Fatal("expected error for missing file, got nil")
 	}
 }
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte("start: \"# BEGIN\"\nexclude: [\"vendor\"]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Start != "# BEGIN" {
+		t.Errorf("Start = %q, want %q", cfg.Start, "# BEGIN")
+	}
+	if len(cfg.Exclude) != 1 || cfg.Exclude[0] != "vendor" {
+		t.Errorf("Exclude = %v, want [vendor]", cfg.Exclude)
+	}
+}
+
+func TestLoad_Rules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".git-sandwich.yml")
+	content := `allow_nesting: true
+rules:
+  - name: ruby
+    start: "# CUSTOM START"
+    end: "# CUSTOM END"
+    include:
+      - "**/*.rb"
+  - name: html
+    start: "<!-- CUSTOM START -->"
+    end: "<!-- CUSTOM END -->"
+    allow_nesting: false
+    exclude:
+      - "vendor"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Rules) != 2 {
+		t.Fatalf("len(Rules) = %d, want 2", len(cfg.Rules))
+	}
+	ruby := cfg.Rules[0]
+	if ruby.Name != "ruby" || ruby.Start != "# CUSTOM START" || ruby.End != "# CUSTOM END" {
+		t.Errorf("Rules[0] = %+v", ruby)
+	}
+	if len(ruby.Include) != 1 || ruby.Include[0] != "**/*.rb" {
+		t.Errorf("Rules[0].Include = %v, want [**/*.rb]", ruby.Include)
+	}
+	if ruby.AllowNesting != nil {
+		t.Errorf("Rules[0].AllowNesting = %v, want nil", *ruby.AllowNesting)
+	}
+	html := cfg.Rules[1]
+	if html.AllowNesting == nil || *html.AllowNesting {
+		t.Errorf("Rules[1].AllowNesting = %v, want false", html.AllowNesting)
+	}
+	if len(html.Exclude) != 1 || html.Exclude[0] != "vendor" {
+		t.Errorf("Rules[1].Exclude = %v, want [vendor]", html.Exclude)
+	}
+}
@@ -0,0 +1,375 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hunk represents a contiguous change between two sequences of lines.
+// Line numbers are 1-indexed. As in unified diffs, a hunk with no old lines
+// has OldStart set to the line after which the new lines are inserted, and
+// vice versa.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+// OldRange returns the range of old lines covered by the hunk, if any.
+func (h Hunk) OldRange() (LineRange, bool) {
+	return LineRange{Start: h.OldStart, End: h.OldStart + h.OldLines - 1}, h.OldLines > 0
+}
+
+// NewRange returns the range of new lines covered by the hunk, if any.
+func (h Hunk) NewRange() (LineRange, bool) {
+	return LineRange{Start: h.NewStart, End: h.NewStart + h.NewLines - 1}, h.NewLines > 0
+}
+
+// MapOldLine returns the line in the new file that corresponds to the given
+// line of the old file. Lines outside the hunks are shifted by the lines
+// added and removed before them. A changed line maps to the first line that
+// replaced it, or, if it was only deleted, to the line before the deletion.
+// The result is never less than 1.
+func MapOldLine(hunks []Hunk, line int) int {
+	delta := 0
+	for _, h := range hunks {
+		if hunkOldBegin(h) > line {
+			break
+		}
+		if line <= hunkOldEnd(h) {
+			if h.NewLines > 0 {
+				return h.NewStart
+			}
+			return max(h.NewStart, 1)
+		}
+		delta += h.NewLines - h.OldLines
+	}
+	return max(line+delta, 1)
+}
+
+// MapNewLine returns the line in the old file that corresponds to the given
+// line of the new file. It is the inverse of MapOldLine.
+func MapNewLine(hunks []Hunk, line int) int {
+	reversed := make([]Hunk, len(hunks))
+	for i, h := range hunks {
+		reversed[i] = Hunk{OldStart: h.NewStart, OldLines: h.NewLines, NewStart: h.OldStart, NewLines: h.OldLines}
+	}
+	return MapOldLine(reversed, line)
+}
+
+// Lines computes the hunks that turn a into b using the Myers algorithm, in
+// linear space.
+func Lines(a, b []string) []Hunk {
+	var hunks []Hunk
+	oldLine, newLine := 0, 0 // next unmatched lines, 0-indexed
+	for _, m := range append(commonLines(a, b), match{a: len(a), b: len(b)}) {
+		if m.a > oldLine || m.b > newLine {
+			h := Hunk{OldStart: oldLine + 1, OldLines: m.a - oldLine, NewStart: newLine + 1, NewLines: m.b - newLine}
+			if h.OldLines == 0 {
+				h.OldStart--
+			}
+			if h.NewLines == 0 {
+				h.NewStart--
+			}
+			hunks = append(hunks, h)
+		}
+		oldLine, newLine = m.a+1, m.b+1
+	}
+	return hunks
+}
+
+// match pairs a line of a with an equal line of b, both 0-indexed.
+type match struct {
+	a, b int
+}
+
+// commonLines returns a longest common subsequence of a and b as matched
+// lines, in order.
+//
+// Lines that occur on only one side can never match, so, as in git, they are
+// left out before searching: a rewritten file then costs no more than its
+// length. The search itself finds the middle snake of the shortest edit
+// script and recurses on both halves, which takes O((N+M)D) time and O(N+M)
+// space for N and M lines and D edits.
+func commonLines(a, b []string) []match {
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	aIDs, bIDs := intern(a), intern(b)
+
+	inA := make([]bool, len(ids))
+	for _, id := range aIDs {
+		inA[id] = true
+	}
+	inB := make([]bool, len(ids))
+	for _, id := range bIDs {
+		inB[id] = true
+	}
+	var s lcs
+	var aLines, bLines []int // positions of the kept lines
+	for i, id := range aIDs {
+		if inB[id] {
+			s.a = append(s.a, id)
+			aLines = append(aLines, i)
+		}
+	}
+	for i, id := range bIDs {
+		if inA[id] {
+			s.b = append(s.b, id)
+			bLines = append(bLines, i)
+		}
+	}
+
+	s.compare(0, len(s.a), 0, len(s.b))
+	for i, m := range s.matches {
+		s.matches[i] = match{a: aLines[m.a], b: bLines[m.b]}
+	}
+	return s.matches
+}
+
+// lcs searches for the common subsequence of two sequences of line ids.
+type lcs struct {
+	a, b    []int
+	matches []match
+	// Furthest reaching x on each diagonal, forward and backward, shared by
+	// every step of the recursion.
+	fwd, bwd []int
+}
+
+// compare appends the matches of a[aLo:aHi] and b[bLo:bHi].
+func (s *lcs) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && s.a[aLo] == s.b[bLo] {
+		s.matches = append(s.matches, match{a: aLo, b: bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi && bLo < bHi && s.a[aHi-1] == s.b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+
+	if aLo < aHi && bLo < bHi {
+		x, y := s.middleSnake(aLo, aHi, bLo, bHi)
+		s.compare(aLo, x, bLo, y)
+		s.compare(x, aHi, y, bHi)
+	}
+
+	for i := range suffix {
+		s.matches = append(s.matches, match{a: aHi + i, b: bHi + i})
+	}
+}
+
+// middleSnake returns a point on a shortest edit script of a[aLo:aHi] and
+// b[bLo:bHi] that splits it into two smaller problems. The ranges must not
+// be empty and must differ in their first and last lines.
+//
+// Paths are extended from both ends at once, one edit per round, until they
+// overlap; the point returned is the end of the forward path that reached
+// the overlap.
+func (s *lcs) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	size := 2*maxD + 3
+	if cap(s.fwd) < size {
+		s.fwd = make([]int, size)
+		s.bwd = make([]int, size)
+	}
+	fwd, bwd := s.fwd[:size], s.bwd[:size]
+	for i := range fwd {
+		fwd[i], bwd[i] = -1, -1
+	}
+	fwd[offset+1], bwd[offset+1] = 0, 0
+
+	// Diagonals k = x - y. The backward search runs on the reversed
+	// sequences; its diagonal delta-k is the forward diagonal k.
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals that have left the grid are skipped from then on
+	fwdStart, fwdEnd, bwdStart, bwdEnd := 0, 0, 0, 0
+	for d := 0; d <= maxD; d++ {
+		for k := -d + fwdStart; k <= d-fwdEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && fwd[offset+k-1] < fwd[offset+k+1]) {
+				x = fwd[offset+k+1]
+			} else {
+				x = fwd[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && s.a[aLo+x] == s.b[bLo+y] {
+				x++
+				y++
+			}
+			fwd[offset+k] = x
+			switch {
+			case x > n:
+				fwdEnd += 2
+			case y > m:
+				fwdStart += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < size && bwd[i] != -1 && x >= n-bwd[i] {
+					return aLo + x, bLo + y
+				}
+			}
+		}
+
+		for k := -d + bwdStart; k <= d-bwdEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && bwd[offset+k-1] < bwd[offset+k+1]) {
+				x = bwd[offset+k+1]
+			} else {
+				x = bwd[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && s.a[aHi-1-x] == s.b[bHi-1-y] {
+				x++
+				y++
+			}
+			bwd[offset+k] = x
+			switch {
+			case x > n:
+				bwdEnd += 2
+			case y > m:
+				bwdStart += 2
+			case !odd:
+				if i := offset + delta - k; i >= 0 && i < size && fwd[i] != -1 {
+					fx := fwd[i]
+					if fx >= n-x {
+						return aLo + fx, bLo + fx - (delta - k)
+					}
+				}
+			}
+		}
+	}
+	// Not reached: the paths meet after at most n+m edits
+	panic("diff: no middle snake")
+}
+
+// SplitLines splits content into lines. Unlike strings.Split, a trailing
+// newline does not produce an extra empty line.
+func SplitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// Unified formats the changes from content a to content b as a unified diff
+// with the given number of context lines. A last line without a newline is
+// followed by "\ No newline at end of file", as in git, so that the patch
+// applies exactly. It returns an empty string if the contents are equal.
+func Unified(oldName, newName, oldContent, newContent string, context int) string {
+	a, b := unifiedLines(oldContent), unifiedLines(newContent)
+	hunks := Lines(a, b)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(hunks); {
+		// Merge hunks whose context would overlap
+		j := i
+		for j+1 < len(hunks) && hunkOldEnd(hunks[j])+2*context >= hunkOldBegin(hunks[j+1]) {
+			j++
+		}
+
+		oldFrom := max(hunkOldBegin(hunks[i])-context, 1)
+		oldTo := min(hunkOldEnd(hunks[j])+context, len(a))
+		newFrom := oldFrom + (hunkNewBegin(hunks[i]) - hunkOldBegin(hunks[i]))
+		newTo := oldTo + (hunkNewEnd(hunks[j]) - hunkOldEnd(hunks[j]))
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", unifiedRange(oldFrom, oldTo), unifiedRange(newFrom, newTo))
+		oldLine := oldFrom
+		for _, h := range hunks[i : j+1] {
+			for ; oldLine < hunkOldBegin(h); oldLine++ {
+				writeUnifiedLine(&sb, ' ', a[oldLine-1])
+			}
+			for k := 0; k < h.OldLines; k++ {
+				writeUnifiedLine(&sb, '-', a[h.OldStart+k-1])
+			}
+			for k := 0; k < h.NewLines; k++ {
+				writeUnifiedLine(&sb, '+', b[h.NewStart+k-1])
+			}
+			oldLine = hunkOldEnd(h) + 1
+		}
+		for ; oldLine <= oldTo; oldLine++ {
+			writeUnifiedLine(&sb, ' ', a[oldLine-1])
+		}
+		i = j + 1
+	}
+	return sb.String()
+}
+
+// unifiedLines splits content into lines for Unified. A last line without a
+// newline keeps a "\n" at its end, which no other line can contain, so that
+// it differs from the same line with a newline.
+func unifiedLines(content string) []string {
+	lines := SplitLines(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+	return lines
+}
+
+// writeUnifiedLine writes a line of a unified diff hunk, marking a line that
+// unifiedLines found without a newline.
+func writeUnifiedLine(sb *strings.Builder, prefix byte, line string) {
+	if text, ok := strings.CutSuffix(line, "\n"); ok {
+		fmt.Fprintf(sb, "%c%s\n\\ No newline at end of file\n", prefix, text)
+		return
+	}
+	fmt.Fprintf(sb, "%c%s\n", prefix, line)
+}
+
+// hunkOldBegin and hunkOldEnd return the old lines spanned by a hunk. For an
+// insertion the span is empty: begin is the line after the insertion point
+// and end is the line before it.
+func hunkOldBegin(h Hunk) int {
+	if h.OldLines == 0 {
+		return h.OldStart + 1
+	}
+	return h.OldStart
+}
+
+func hunkOldEnd(h Hunk) int {
+	return hunkOldBegin(h) + h.OldLines - 1
+}
+
+func hunkNewBegin(h Hunk) int {
+	if h.NewLines == 0 {
+		return h.NewStart + 1
+	}
+	return h.NewStart
+}
+
+func hunkNewEnd(h Hunk) int {
+	return hunkNewBegin(h) + h.NewLines - 1
+}
+
+// unifiedRange formats a 1-indexed inclusive range as a unified diff hunk
+// range. An empty range is written as the line before it with length 0.
+func unifiedRange(from, to int) string {
+	switch n := to - from + 1; n {
+	case 0:
+		return fmt.Sprintf("%d,0", from-1)
+	case 1:
+		return fmt.Sprintf("%d", from)
+	default:
+		return fmt.Sprintf("%d,%d", from, n)
+	}
+}
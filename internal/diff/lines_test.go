@@ -0,0 +1,300 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []Hunk
+	}{
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"both empty", nil, nil, nil},
+		{"insert into empty", nil, []string{"a", "b"}, []Hunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2}}},
+		{"delete all", []string{"a", "b"}, nil, []Hunk{{OldStart: 1, OldLines: 2, NewStart: 0, NewLines: 0}}},
+		{"replace middle", []string{"a", "b", "c"}, []string{"a", "x", "y", "c"}, []Hunk{{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 2}}},
+		{"insert after", []string{"a", "b"}, []string{"a", "x", "b"}, []Hunk{{OldStart: 1, OldLines: 0, NewStart: 2, NewLines: 1}}},
+		{"delete first", []string{"a", "b", "c"}, []string{"b", "c"}, []Hunk{{OldStart: 1, OldLines: 1, NewStart: 0, NewLines: 0}}},
+		{"two hunks", []string{"a", "b", "c", "d", "e"}, []string{"x", "b", "c", "d", "y"}, []Hunk{
+			{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1},
+			{OldStart: 5, OldLines: 1, NewStart: 5, NewLines: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("hunk %d: expected %+v, got %+v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMapOldLine(t *testing.T) {
+	// 1 2 3 4 5 6 7 8 -> 1 X 3 4 6 7 Y Z 8
+	hunks := []Hunk{
+		{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 1},
+		{OldStart: 5, OldLines: 1, NewStart: 4, NewLines: 0},
+		{OldStart: 7, OldLines: 0, NewStart: 7, NewLines: 2},
+	}
+	tests := []struct{ old, want int }{
+		{1, 1}, // before any hunk
+		{2, 2}, // replaced
+		{4, 4}, // between hunks
+		{5, 4}, // deleted: line before the deletion
+		{6, 5}, // shifted by the deletion
+		{7, 6}, // insertion comes after line 7
+		{8, 9}, // shifted by the insertion
+	}
+	for _, tt := range tests {
+		if got := MapOldLine(hunks, tt.old); got != tt.want {
+			t.Errorf("MapOldLine(%d): expected %d, got %d", tt.old, tt.want, got)
+		}
+	}
+
+	deleteFirst := []Hunk{{OldStart: 1, OldLines: 1, NewStart: 0, NewLines: 0}}
+	if got := MapOldLine(deleteFirst, 1); got != 1 {
+		t.Errorf("expected deletion of the first line to map to 1, got %d", got)
+	}
+}
+
+func TestMapNewLine(t *testing.T) {
+	// 1 2 3 4 5 6 7 8 -> 1 X 3 4 6 7 Y Z 8
+	hunks := []Hunk{
+		{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 1},
+		{OldStart: 5, OldLines: 1, NewStart: 4, NewLines: 0},
+		{OldStart: 7, OldLines: 0, NewStart: 7, NewLines: 2},
+	}
+	tests := []struct{ new, want int }{
+		{1, 1}, {2, 2}, {4, 4}, {5, 6}, {6, 7}, {7, 7}, {9, 8},
+	}
+	for _, tt := range tests {
+		if got := MapNewLine(hunks, tt.new); got != tt.want {
+			t.Errorf("MapNewLine(%d): expected %d, got %d", tt.new, tt.want, got)
+		}
+	}
+}
+
+func TestLines_MatchesGitRanges(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+	b := []string{"1", "X", "3", "4", "6", "7", "Y", "Z", "8"}
+	var oldRanges, newRanges []LineRange
+	for _, h := range Lines(a, b) {
+		if r, ok := h.OldRange(); ok {
+			oldRanges = append(oldRanges, r)
+		}
+		if r, ok := h.NewRange(); ok {
+			newRanges = append(newRanges, r)
+		}
+	}
+	wantOld := []LineRange{{2, 2}, {5, 5}}
+	wantNew := []LineRange{{2, 2}, {7, 8}}
+	if len(oldRanges) != len(wantOld) || oldRanges[0] != wantOld[0] || oldRanges[1] != wantOld[1] {
+		t.Errorf("expected old ranges %+v, got %+v", wantOld, oldRanges)
+	}
+	if len(newRanges) != len(wantNew) || newRanges[0] != wantNew[0] || newRanges[1] != wantNew[1] {
+		t.Errorf("expected new ranges %+v, got %+v", wantNew, newRanges)
+	}
+}
+
+func TestLines_Reconstructs(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := gen(), gen()
+
+		// Apply the hunks to a and check that the result is b
+		var got []string
+		next := 1 // next old line to copy
+		for _, h := range Lines(a, b) {
+			end := h.OldStart
+			if h.OldLines == 0 {
+				end++
+			}
+			got = append(got, a[next-1:end-1]...)
+			got = append(got, b[max(h.NewStart, 1)-1:max(h.NewStart, 1)-1+h.NewLines]...)
+			next = end + h.OldLines
+		}
+		got = append(got, a[next-1:]...)
+
+		if strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("Lines(%q, %q) does not reconstruct b: got %q", a, b, got)
+		}
+	}
+}
+
+func TestLines_Minimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	gen := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := gen(), gen()
+
+		// The longest common subsequence, by dynamic programming
+		dp := make([][]int, len(a)+1)
+		for i := range dp {
+			dp[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					dp[i][j] = dp[i+1][j+1] + 1
+				} else {
+					dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+				}
+			}
+		}
+
+		edits := 0
+		for _, h := range Lines(a, b) {
+			edits += h.OldLines + h.NewLines
+		}
+		if want := len(a) + len(b) - 2*dp[0][0]; edits != want {
+			t.Fatalf("Lines(%q, %q): expected %d edits, got %d", a, b, want, edits)
+		}
+	}
+}
+
+func TestLines_LargeRewrite(t *testing.T) {
+	// Every line rewritten, and every tenth line of both a closing brace,
+	// as in generated code
+	const n = 100000
+	a, b := make([]string, n), make([]string, n)
+	for i := range n {
+		a[i], b[i] = fmt.Sprintf("old %d", i), fmt.Sprintf("new %d", i)
+		if i%10 == 0 {
+			a[i], b[i] = "}", "}"
+		}
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	hunks := Lines(a, b)
+	runtime.ReadMemStats(&after)
+
+	if len(hunks) != n/10 {
+		t.Errorf("expected %d hunks, got %d", n/10, len(hunks))
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 200<<20 {
+		t.Errorf("expected memory linear in the input, allocated %d MB", alloc>>20)
+	}
+
+	// Shuffled lines leave many edits between the common ones
+	b = append([]string{}, a...)
+	rand.New(rand.NewSource(3)).Shuffle(len(b), func(i, j int) { b[i], b[j] = b[j], b[i] })
+	runtime.ReadMemStats(&before)
+	Lines(a[:20000], b[:20000])
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 200<<20 {
+		t.Errorf("expected memory linear in the input, allocated %d MB", alloc>>20)
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a\n", 1},
+		{"a\nb", 2},
+		{"a\n\n", 2},
+	}
+	for _, tt := range tests {
+		if got := SplitLines(tt.in); len(got) != tt.want {
+			t.Errorf("SplitLines(%q) = %q, want %d lines", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\n"
+	got := Unified("a/f", "b/f", a, b, 1)
+	want := `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ 1
+-2
++two
+ 3
+@@ -10 +10,2 @@
+ 10
++11
+`
+	if got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if got := Unified("a/f", "b/f", a, a, 3); got != "" {
+		t.Errorf("expected empty diff for equal input, got %q", got)
+	}
+}
+
+func TestUnified_NoNewlineAtEnd(t *testing.T) {
+	tests := []struct {
+		name, a, b, want string
+	}{
+		{"removed", "1\n2\n", "1\n2", `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ 1
+-2
++2
+\ No newline at end of file
+`},
+		{"added", "1\n2", "1\n2\n", `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ 1
+-2
+\ No newline at end of file
++2
+`},
+		{"context", "1\n2\n3", "one\n2\n3", `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+\ No newline at end of file
+`},
+		{"new file", "", "1", `--- a/f
++++ b/f
+@@ -0,0 +1 @@
++1
+\ No newline at end of file
+`},
+	}
+	for _, tt := range tests {
+		if got := Unified("a/f", "b/f", tt.a, tt.b, 3); got != tt.want {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -18,6 +18,7 @@ type FileDiff struct {
 	IsDeleted bool
 	OldRanges []LineRange
 	NewRanges []LineRange
+	Hunks     []Hunk
 }
 
 // Parse parses a unified diff (produced with -U0) and returns per-file diff info.
@@ -37,6 +38,13 @@ func Parse(diffBytes []byte) ([]FileDiff, error) {
 		}
 
 		for _, hunk := range fd.Hunks {
+			fileDiff.Hunks = append(fileDiff.Hunks, Hunk{
+				OldStart: int(hunk.OrigStartLine),
+				OldLines: int(hunk.OrigLines),
+				NewStart: int(hunk.NewStartLine),
+				NewLines: int(hunk.NewLines),
+			})
+
 			// Old side (deletions)
 			if hunk.OrigLines > 0 {
 				fileDiff.OldRanges = append(fileDiff.OldRanges, LineRange{
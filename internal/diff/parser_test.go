@@ -209,4 +209,8 @@ index 1234567..abcdefg 100644
 	if len(f.NewRanges) != 0 {
 		t.Errorf("expected 0 NewRanges for delete-only, got %d", len(f.NewRanges))
 	}
+	want := Hunk{OldStart: 3, OldLines: 2, NewStart: 2, NewLines: 0}
+	if len(f.Hunks) != 1 || f.Hunks[0] != want {
+		t.Errorf("expected hunk %+v, got %+v", want, f.Hunks)
+	}
 }
@@ -0,0 +1,316 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// FileRef names a file at a ref.
+type FileRef struct {
+	Ref  string
+	Path string
+}
+
+// Prefetcher is implemented by repositories that can read many files more
+// cheaply at once than one by one. Prefetch reads the files ahead of the
+// GetFileContent calls for them.
+type Prefetcher interface {
+	Prefetch(ctx context.Context, files []FileRef) error
+}
+
+// BatchRepository implements Repository with the git command, like
+// ExecRepository, but reads files through a single long-running
+// git cat-file --batch process instead of starting one process per file.
+// Files passed to Prefetch are requested in one pipelined round trip.
+//
+// The process is started on first use and runs until Close is called or the
+// program exits.
+type BatchRepository struct {
+	// Everything but file contents comes from the git command.
+	ExecRepository
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// process is the running process, for killing it without the lock.
+	process atomic.Pointer[os.Process]
+	// refs maps refs to the commits they resolved to.
+	refs map[string]string
+	// prefetched holds the files read by the last Prefetch until Close or
+	// the next Prefetch, so that every rule reading a file is served from it.
+	prefetched map[string]batchObject
+}
+
+type batchObject struct {
+	content string
+	exists  bool
+}
+
+// NewBatchRepository returns a BatchRepository for the repository containing
+// the current directory.
+func NewBatchRepository() *BatchRepository {
+	return &BatchRepository{
+		refs:       make(map[string]string),
+		prefetched: make(map[string]batchObject),
+	}
+}
+
+// GetFileContent returns the same content as the package-level
+// GetFileContent, reading it from the cat-file process. The process is
+// killed if ctx is done before the file is read, and started again on next
+// use.
+func (r *BatchRepository) GetFileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	switch ref {
+	case WorktreeRef:
+		return readWorktreeFile(ctx, path)
+	case EmptyTree:
+		return "", false, nil
+	}
+
+	var obj batchObject
+	err := r.withProcess(ctx, func() error {
+		name, err := r.objectName(ctx, ref, path)
+		if err != nil {
+			return err
+		}
+		if o, ok := r.prefetched[name]; ok {
+			obj = o
+			return nil
+		}
+		if err := r.request([]string{name}); err != nil {
+			r.kill()
+			return err
+		}
+		if obj, err = r.readObject(); err != nil {
+			r.kill()
+		}
+		return err
+	})
+	return obj.content, obj.exists, err
+}
+
+// withProcess calls f with the lock held, killing the process if ctx is done
+// before f returns.
+func (r *BatchRepository) withProcess(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		if p := r.process.Load(); p != nil {
+			p.Kill()
+		}
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := f()
+	if !stop() {
+		// The process may have been killed after f was done with it
+		r.kill()
+		return ctx.Err()
+	}
+	return err
+}
+
+// Prefetch reads the given files from the cat-file process, replacing the
+// files of the previous call; those requested again are kept without being
+// read twice. All requests are written before the first response is read, so
+// the process never waits for the next request. Working tree files are
+// skipped.
+func (r *BatchRepository) Prefetch(ctx context.Context, files []FileRef) error {
+	return r.withProcess(ctx, func() error {
+		return r.prefetch(ctx, files)
+	})
+}
+
+func (r *BatchRepository) prefetch(ctx context.Context, files []FileRef) error {
+	previous := r.prefetched
+	r.prefetched = make(map[string]batchObject)
+	var names []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if f.Ref == WorktreeRef || f.Ref == EmptyTree {
+			continue
+		}
+		name, err := r.objectName(ctx, f.Ref, f.Path)
+		if err != nil {
+			return err
+		}
+		if obj, ok := previous[name]; ok {
+			r.prefetched[name] = obj
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	if err := r.ensureStarted(); err != nil {
+		return err
+	}
+	// Requests are written concurrently: a pipe holds only so much, and the
+	// process stops reading once its output is not read.
+	written := make(chan error, 1)
+	go func(w io.Writer) {
+		written <- writeNames(w, names)
+	}(r.stdin)
+	var readErr error
+	for _, name := range names {
+		obj, err := r.readObject()
+		if err != nil {
+			readErr = err
+			break
+		}
+		r.prefetched[name] = obj
+	}
+	if readErr != nil {
+		r.kill()
+		<-written
+		return readErr
+	}
+	if err := <-written; err != nil {
+		r.kill()
+		return err
+	}
+	return nil
+}
+
+// Close stops the cat-file process and drops the prefetched files.
+func (r *BatchRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.prefetched)
+	return r.stop()
+}
+
+// objectName returns the cat-file name of a file. Refs are resolved once, so
+// that a missing file can be told apart from an invalid ref.
+func (r *BatchRepository) objectName(ctx context.Context, ref, path string) (string, error) {
+	if strings.Contains(path, "\n") {
+		return "", fmt.Errorf("unsupported path %q", path)
+	}
+	if ref == StagedRef {
+		return ":" + path, nil
+	}
+	commit, ok := r.refs[ref]
+	if !ok {
+		out, err := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+		}
+		commit = strings.TrimSpace(string(out))
+		r.refs[ref] = commit
+	}
+	return commit + ":" + path, nil
+}
+
+// request writes object names to the cat-file process, starting it if needed.
+func (r *BatchRepository) request(names []string) error {
+	if err := r.ensureStarted(); err != nil {
+		return err
+	}
+	return writeNames(r.stdin, names)
+}
+
+func writeNames(w io.Writer, names []string) error {
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		bw.WriteString(name)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ensureStarted starts the cat-file process if it is not running.
+func (r *BatchRepository) ensureStarted() error {
+	if r.cmd != nil {
+		return nil
+	}
+	cmd := exec.Command("git", "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	r.cmd = cmd
+	r.process.Store(cmd.Process)
+	r.stdin = stdin
+	r.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+// kill stops the process after a failed request, when it may be out of step
+// with the requests. It is started again on next use.
+func (r *BatchRepository) kill() {
+	if r.cmd != nil {
+		r.cmd.Process.Kill()
+		r.stop()
+	}
+}
+
+func (r *BatchRepository) stop() error {
+	if r.cmd == nil {
+		return nil
+	}
+	r.stdin.Close()
+	err := r.cmd.Wait()
+	r.cmd = nil
+	r.process.Store(nil)
+	return err
+}
+
+// readObject reads one response of the cat-file process: a header line
+// "<oid> <type> <size>" followed by the content and a newline, or
+// "<name> missing". Anything but a blob is reported as missing, like a
+// path that does not exist.
+func (r *BatchRepository) readObject() (batchObject, error) {
+	if r.cmd == nil {
+		return batchObject{}, errors.New("git cat-file is not running")
+	}
+	header, err := r.stdout.ReadString('\n')
+	if err != nil {
+		return batchObject{}, fmt.Errorf("failed to read from git cat-file: %w", err)
+	}
+	header = strings.TrimSuffix(header, "\n")
+	if strings.HasSuffix(header, " missing") || strings.HasSuffix(header, " ambiguous") {
+		return batchObject{}, nil
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return batchObject{}, fmt.Errorf("unexpected git cat-file output %q", header)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return batchObject{}, fmt.Errorf("unexpected git cat-file output %q", header)
+	}
+	data := make([]byte, size+1) // content and the trailing newline
+	if _, err := io.ReadFull(r.stdout, data); err != nil {
+		return batchObject{}, fmt.Errorf("failed to read from git cat-file: %w", err)
+	}
+	if fields[1] != "blob" {
+		return batchObject{}, nil
+	}
+	return batchObject{content: string(data[:size]), exists: true}, nil
+}
@@ -0,0 +1,184 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestBatch_GetFileContent(t *testing.T) {
+	dir := setupChanges(t)
+	chdir(t, dir)
+	write(t, dir, "app.rb", "worktree\n")
+
+	refs := []string{"main", "HEAD", "HEAD~1", StagedRef, WorktreeRef, EmptyTree}
+	paths := []string{"app.rb", "lib/nested.rb", "moved.rb", "missing.rb", "data.bin"}
+
+	for _, withPrefetch := range []bool{false, true} {
+		repo := NewBatchRepository()
+		defer repo.Close()
+		if withPrefetch {
+			var files []FileRef
+			for _, ref := range refs {
+				for _, path := range paths {
+					files = append(files, FileRef{Ref: ref, Path: path})
+				}
+			}
+			if err := repo.Prefetch(t.Context(), files); err != nil {
+				t.Fatalf("Prefetch failed: %v", err)
+			}
+		}
+		for _, ref := range refs {
+			for _, path := range paths {
+				wantContent, wantExists, wantErr := GetFileContent(t.Context(), ref, path)
+				content, exists, err := repo.GetFileContent(t.Context(), ref, path)
+				if (err != nil) != (wantErr != nil) || exists != wantExists || content != wantContent {
+					t.Errorf("prefetch=%v %s:%s: expected (%q, %v, %v), got (%q, %v, %v)",
+						withPrefetch, ref, path, wantContent, wantExists, wantErr, content, exists, err)
+				}
+			}
+		}
+	}
+}
+
+func TestBatch_UnknownRef(t *testing.T) {
+	dir := setupChanges(t)
+	chdir(t, dir)
+
+	repo := NewBatchRepository()
+	defer repo.Close()
+	if _, _, err := repo.GetFileContent(t.Context(), "no-such-ref", "app.rb"); err == nil {
+		t.Error("expected error for unknown ref")
+	}
+	if err := repo.Prefetch(t.Context(), []FileRef{{Ref: "no-such-ref", Path: "app.rb"}}); err == nil {
+		t.Error("expected error for unknown ref")
+	}
+	// The process is still usable
+	if _, exists, err := repo.GetFileContent(t.Context(), "main", "app.rb"); err != nil || !exists {
+		t.Errorf("expected app.rb at main, got exists=%v err=%v", exists, err)
+	}
+}
+
+func TestBatch_PrefetchMany(t *testing.T) {
+	// More requests than fit in a pipe buffer
+	dir, files := setupSyntheticRepo(t, 2000)
+	chdir(t, dir)
+
+	repo := NewBatchRepository()
+	defer repo.Close()
+	if err := repo.Prefetch(t.Context(), files); err != nil {
+		t.Fatalf("Prefetch failed: %v", err)
+	}
+	for _, f := range files {
+		content, exists, err := repo.GetFileContent(t.Context(), f.Ref, f.Path)
+		if err != nil || !exists || content != syntheticContent(f) {
+			t.Fatalf("%s:%s: unexpected content %q (exists=%v, err=%v)", f.Ref, f.Path, content, exists, err)
+		}
+	}
+}
+
+func TestBatch_PrefetchKept(t *testing.T) {
+	dir, files := setupSyntheticRepo(t, 3)
+	chdir(t, dir)
+
+	repo := NewBatchRepository()
+	defer repo.Close()
+	if err := repo.Prefetch(t.Context(), files); err != nil {
+		t.Fatalf("Prefetch failed: %v", err)
+	}
+	// Without the process, only prefetched files can be read
+	repo.stop()
+	t.Setenv("PATH", "")
+
+	for range 2 {
+		for _, f := range files {
+			if content, _, err := repo.GetFileContent(t.Context(), f.Ref, f.Path); err != nil || content != syntheticContent(f) {
+				t.Fatalf("%s:%s: expected prefetched content, got %q (err=%v)", f.Ref, f.Path, content, err)
+			}
+		}
+	}
+
+	// The next Prefetch keeps the files it asks for again, and only those
+	if err := repo.Prefetch(t.Context(), files[:1]); err != nil {
+		t.Fatalf("Prefetch failed: %v", err)
+	}
+	if _, _, err := repo.GetFileContent(t.Context(), files[0].Ref, files[0].Path); err != nil {
+		t.Errorf("expected %s to be kept, got %v", files[0].Path, err)
+	}
+	if _, _, err := repo.GetFileContent(t.Context(), files[1].Ref, files[1].Path); err == nil {
+		t.Errorf("expected %s to be dropped", files[1].Path)
+	}
+}
+
+// setupSyntheticRepo creates a repository with n files that all change
+// between main and feature, and returns the base and head version of each.
+func setupSyntheticRepo(tb testing.TB, n int) (string, []FileRef) {
+	tb.Helper()
+	dir := setupRepo(tb)
+
+	var files []FileRef
+	for _, ref := range []string{"main", "feature"} {
+		for i := range n {
+			f := FileRef{Ref: ref, Path: fmt.Sprintf("dir%02d/file%04d.rb", i%50, i)}
+			write(tb, dir, filepath.FromSlash(f.Path), syntheticContent(f))
+			files = append(files, f)
+		}
+		if ref == "feature" {
+			run(tb, dir, "checkout", "-q", "-b", "feature")
+		}
+		run(tb, dir, "add", "-A")
+		run(tb, dir, "commit", "-q", "-m", ref)
+	}
+	return dir, files
+}
+
+func syntheticContent(f FileRef) string {
+	return fmt.Sprintf("# %s\n# START\ncontent of %s at %s\n# END\n", f.Path, f.Path, f.Ref)
+}
+
+// BenchmarkFileContent reads the base and head version of every file of a
+// change to 2000 files.
+func BenchmarkFileContent(b *testing.B) {
+	dir, files := setupSyntheticRepo(b, 2000)
+	chdir(b, dir)
+
+	readAll := func(b *testing.B, repo Repository) {
+		for _, f := range files {
+			if _, _, err := repo.GetFileContent(b.Context(), f.Ref, f.Path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("exec", func(b *testing.B) {
+		for range b.N {
+			readAll(b, ExecRepository{})
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		repo := NewBatchRepository()
+		defer repo.Close()
+		for range b.N {
+			readAll(b, repo)
+		}
+	})
+	b.Run("batch-prefetch", func(b *testing.B) {
+		repo := NewBatchRepository()
+		defer repo.Close()
+		for range b.N {
+			if err := repo.Prefetch(b.Context(), files); err != nil {
+				b.Fatal(err)
+			}
+			readAll(b, repo)
+		}
+	})
+	b.Run("go-git", func(b *testing.B) {
+		repo, err := OpenGoGit(dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for range b.N {
+			readAll(b, repo)
+		}
+	})
+}
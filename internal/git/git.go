@@ -1,27 +1,199 @@
 package git
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
+// Pseudo-refs that can be used in place of a head ref to validate changes
+// that have not been committed yet.
+const (
+	// StagedRef resolves to the content staged in the index.
+	StagedRef = ":staged"
+	// WorktreeRef resolves to the files in the working tree.
+	WorktreeRef = ":worktree"
+)
+
+// EmptyTree is the object name of the tree without any files. As a base
+// ref, it makes every file of the head ref a new file.
+const EmptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// ZeroSHA is the object name git uses for the missing side of a ref update,
+// i.e. the old value of a created ref or the new value of a deleted one.
+const ZeroSHA = "0000000000000000000000000000000000000000"
+
+// IsZeroSHA returns true if sha consists only of zeros. Both SHA-1 and
+// SHA-256 object names are recognized.
+func IsZeroSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+// IsPseudoRef returns true if ref is StagedRef or WorktreeRef.
+func IsPseudoRef(ref string) bool {
+	return ref == StagedRef || ref == WorktreeRef
+}
+
 // GetDiff runs git diff -U0 base...head -- [paths] and returns the raw diff output.
-func GetDiff(baseRef, headRef string, paths []string) ([]byte, error) {
-	args := []string{"diff", "-U0", baseRef + "..." + headRef, "--"}
+// When headRef is a pseudo-ref, the index or working tree is compared against
+// the merge base of baseRef and HEAD instead. EmptyTree as baseRef is compared
+// against headRef directly, as it has no merge base. The git command is
+// killed if ctx is done before it completes, as in every function of this
+// package that runs it.
+func GetDiff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error) {
+	args := []string{"diff", "-U0"}
+	switch {
+	case baseRef == EmptyTree:
+		switch headRef {
+		case StagedRef:
+			args = append(args, "--cached", baseRef)
+		case WorktreeRef:
+			args = append(args, baseRef)
+		default:
+			args = append(args, baseRef, headRef)
+		}
+	case headRef == StagedRef:
+		args = append(args, "--cached", "--merge-base", baseRef)
+	case headRef == WorktreeRef:
+		args = append(args, "--merge-base", baseRef)
+	default:
+		args = append(args, baseRef+"..."+headRef)
+	}
+	args = append(args, "--")
 	if len(paths) > 0 {
 		args = append(args, paths...)
 	}
-	cmd := exec.Command("git", args...)
-	return cmd.Output()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	return output(cmd)
 }
 
 // GetFileContent retrieves the content of a file at a given ref using git show.
 // Returns the content, whether the file exists, and any error.
-func GetFileContent(ref, path string) (string, bool, error) {
-	cmd := exec.Command("git", "show", ref+":"+path)
-	out, err := cmd.Output()
+func GetFileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	switch ref {
+	case StagedRef:
+		return showObject(ctx, ":"+path)
+	case WorktreeRef:
+		return readWorktreeFile(ctx, path)
+	case EmptyTree:
+		return "", false, nil
+	}
+	return showObject(ctx, ref+":"+path)
+}
+
+// ListFiles returns the paths of all tracked files at a ref, relative to the
+// repository root. For the pseudo-refs the files in the index are listed.
+func ListFiles(ctx context.Context, ref string) ([]string, error) {
+	var cmd *exec.Cmd
+	if IsPseudoRef(ref) {
+		cmd = exec.CommandContext(ctx, "git", "ls-files", "-z", "--full-name", "--", ":/")
+	} else {
+		cmd = exec.CommandContext(ctx, "git", "ls-tree", "-r", "-z", "--name-only", "--full-tree", ref)
+	}
+	out, err := output(cmd)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// Commit represents a commit and its parents.
+type Commit struct {
+	SHA     string
+	Parents []string
+}
+
+// ListCommits returns the commits in base..head, oldest first. With EmptyTree
+// as baseRef, every commit reachable from headRef is returned.
+func ListCommits(ctx context.Context, baseRef, headRef string) ([]Commit, error) {
+	revs := baseRef + ".." + headRef
+	if baseRef == EmptyTree {
+		revs = headRef
+	}
+	cmd := exec.CommandContext(ctx, "git", "rev-list", "--topo-order", "--reverse", "--parents", revs, "--")
+	out, err := output(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		commits = append(commits, Commit{SHA: fields[0], Parents: fields[1:]})
+	}
+	return commits, nil
+}
+
+// RepoPath converts a path relative to the current directory into a path
+// relative to the repository root, as used in diffs.
+func RepoPath(ctx context.Context, path string) (string, error) {
+	out, err := output(exec.CommandContext(ctx, "git", "rev-parse", "--show-prefix"))
+	if err != nil {
+		return "", err
+	}
+	prefix := strings.TrimSpace(string(out))
+	return filepath.ToSlash(filepath.Join(prefix, path)), nil
+}
+
+// MergeBase returns the best common ancestor of two commits.
+func MergeBase(ctx context.Context, a, b string) (string, error) {
+	out, err := output(exec.CommandContext(ctx, "git", "merge-base", a, b))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// WorktreePath converts a path relative to the repository root, as used in
+// diffs, into a path in the working tree.
+func WorktreePath(ctx context.Context, path string) (string, error) {
+	out, err := output(exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel"))
+	if err != nil {
+		return "", err
+	}
+	root := strings.TrimSpace(string(out))
+	return filepath.Join(root, filepath.FromSlash(path)), nil
+}
+
+// NewCommitBase returns the parent of the oldest commit reachable from rev but
+// not from any existing ref, or EmptyTree if that commit has no parent. The
+// second return value is false when rev introduces no new commits.
+func NewCommitBase(ctx context.Context, rev string) (string, bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-list", "--topo-order", "--reverse", "--parents", rev, "--not", "--all")
+	out, err := output(cmd)
+	if err != nil {
+		return "", false, err
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)
+	fields := strings.Fields(lines[0])
+	switch len(fields) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return EmptyTree, true, nil
+	}
+	return fields[1], true, nil
+}
+
+func showObject(ctx context.Context, object string) (string, bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "show", object)
+	out, err := output(cmd)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
 			stderr := string(exitErr.Stderr)
 			if strings.Contains(stderr, "does not exist") ||
 				strings.Contains(stderr, "not exist in") ||
@@ -33,3 +205,50 @@ func GetFileContent(ref, path string) (string, bool, error) {
 	}
 	return string(out), true, nil
 }
+
+// output runs a git command and returns its standard output. If it fails,
+// the error carries what git printed to standard error.
+func output(cmd *exec.Cmd) ([]byte, error) {
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+		return out, &commandError{exitErr}
+	}
+	return out, err
+}
+
+// commandError is a failed git command. Its message is git's own.
+type commandError struct {
+	*exec.ExitError
+}
+
+func (e *commandError) Error() string {
+	return string(bytes.TrimSpace(e.Stderr))
+}
+
+func (e *commandError) Unwrap() error {
+	return e.ExitError
+}
+
+// readWorktreeFile reads a file from the working tree. Diff paths are relative
+// to the repository root, so the path is resolved against the top-level directory.
+func readWorktreeFile(ctx context.Context, path string) (string, bool, error) {
+	fullPath, err := WorktreePath(ctx, path)
+	if err != nil {
+		return "", false, err
+	}
+	return readFile(fullPath)
+}
+
+// readFile reads a file, reporting a missing file as not existing rather
+// than as an error.
+func readFile(fullPath string) (string, bool, error) {
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return string(data), true, nil
+}
@@ -0,0 +1,30 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCommandError(t *testing.T) {
+	dir := setupRepo(t)
+	write(t, dir, "app.rb", "line 1\n")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", "base")
+	chdir(t, dir)
+
+	_, _, err := GetFileContent(t.Context(), "no-such-ref", "app.rb")
+	if err == nil || !strings.Contains(err.Error(), "no-such-ref") {
+		t.Errorf("expected git's message about no-such-ref, got %v", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("expected an *exec.ExitError, got %T", err)
+	}
+
+	chdir(t, t.TempDir())
+	if _, err := RepoPath(t.Context(), "x"); err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("expected git's message outside a repository, got %v", err)
+	}
+}
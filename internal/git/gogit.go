@@ -0,0 +1,961 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+// renameScore is the minimum similarity, in percent, for a deleted and an
+// added file to be reported as a rename, as in git.
+const renameScore = 50
+
+// renameLimit bounds the number of deleted and added files compared for
+// inexact renames, as diff.renameLimit does in git.
+const renameLimit = 1000
+
+// GoGitRepository implements Repository in process with go-git, so no git
+// command is needed.
+//
+// Its diffs follow the output of GetDiff closely enough for validation, with
+// these differences: paths are matched as files or directories, not as
+// pathspecs; renames are detected by comparing lines rather than with git's
+// similarity heuristic; and when a change could be placed in more than one
+// way, hunks may be placed differently.
+type GoGitRepository struct {
+	// go-git repositories are not safe for concurrent use.
+	mu     sync.Mutex
+	repo   *gogit.Repository
+	root   string // working tree root; empty for a bare repository
+	prefix string // directory the repository was opened from, relative to root
+	trees  map[string]*object.Tree
+}
+
+// ErrObjectDirectory is returned by OpenGoGit when git has moved the objects
+// elsewhere, as it does for the objects of a push while the receiving hooks
+// run. go-git does not read GIT_OBJECT_DIRECTORY or
+// GIT_ALTERNATE_OBJECT_DIRECTORIES, so it would not see them.
+var ErrObjectDirectory = errors.New("the go-git backend cannot read objects from GIT_OBJECT_DIRECTORY or GIT_ALTERNATE_OBJECT_DIRECTORIES, as in server-side hooks; use the exec or batch backend")
+
+// OpenGoGit opens the repository containing dir, which may be bare.
+func OpenGoGit(dir string) (*GoGitRepository, error) {
+	if os.Getenv("GIT_OBJECT_DIRECTORY") != "" || os.Getenv("GIT_ALTERNATE_OBJECT_DIRECTORIES") != "" {
+		return nil, ErrObjectDirectory
+	}
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
+	if errors.Is(err, gogit.ErrRepositoryNotExists) {
+		repo, err = openBare(dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	r := &GoGitRepository{repo: repo, trees: make(map[string]*object.Tree)}
+	if wt, err := repo.Worktree(); err == nil {
+		r.root = wt.Filesystem.Root()
+		r.prefix, err = relativePrefix(r.root, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// openBare opens the bare repository containing dir. Bare repositories have
+// no .git directory for go-git to detect, so dir and each of its parents are
+// tried in turn.
+func openBare(dir string) (*gogit.Repository, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		repo, err := gogit.PlainOpen(path)
+		if err == nil {
+			return repo, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil, gogit.ErrRepositoryNotExists
+		}
+		path = parent
+	}
+}
+
+// GetDiff returns the same diff as the package-level GetDiff.
+func (r *GoGitRepository) GetDiff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	headCommitRef := headRef
+	if IsPseudoRef(headRef) {
+		headCommitRef = "HEAD"
+	}
+	baseTree, err := r.tree(EmptyTree)
+	if baseRef != EmptyTree {
+		var base *object.Commit
+		if base, err = r.mergeBase(baseRef, headCommitRef); err != nil {
+			return nil, err
+		}
+		if baseTree, err = base.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the files that may differ are collected.
+	var oldFiles, newFiles map[string]treeFile
+	if IsPseudoRef(headRef) {
+		if oldFiles, err = flattenTree(baseTree); err != nil {
+			return nil, err
+		}
+		if newFiles, err = r.indexFiles(headRef == WorktreeRef); err != nil {
+			return nil, err
+		}
+	} else {
+		headTree, err := r.tree(headRef)
+		if err != nil {
+			return nil, err
+		}
+		if oldFiles, newFiles, err = changedFiles(baseTree, headTree); err != nil {
+			return nil, err
+		}
+	}
+
+	specs := r.pathSpecs(paths)
+	changes := compareFiles(filterSpecs(oldFiles, specs), filterSpecs(newFiles, specs))
+	if changes, err = r.detectRenames(ctx, changes); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, c := range changes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := r.writeFileDiff(&buf, c); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// GetFileContent returns the same content as the package-level GetFileContent.
+func (r *GoGitRepository) GetFileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ref {
+	case WorktreeRef:
+		if r.root == "" {
+			return "", false, errors.New("repository has no working tree")
+		}
+		return readFile(filepath.Join(r.root, filepath.FromSlash(path)))
+	case StagedRef:
+		idx, err := r.repo.Storer.Index()
+		if err != nil {
+			return "", false, err
+		}
+		entry, err := idx.Entry(path)
+		if errors.Is(err, index.ErrEntryNotFound) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		content, err := r.blob(entry.Hash)
+		return content, err == nil, err
+	}
+
+	tree, err := r.tree(ref)
+	if err != nil {
+		return "", false, err
+	}
+	entry, err := tree.FindEntry(path)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !entry.Mode.IsFile() {
+		return "", false, nil
+	}
+	content, err := r.blob(entry.Hash)
+	return content, err == nil, err
+}
+
+// ListFiles returns the same paths as the package-level ListFiles.
+func (r *GoGitRepository) ListFiles(ctx context.Context, ref string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var paths []string
+	if IsPseudoRef(ref) {
+		idx, err := r.repo.Storer.Index()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range idx.Entries {
+			// Unmerged files have an entry per stage
+			if n := len(paths); n == 0 || paths[n-1] != e.Name {
+				paths = append(paths, e.Name)
+			}
+		}
+		return paths, nil
+	}
+
+	tree, err := r.tree(ref)
+	if err != nil {
+		return nil, err
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode != filemode.Dir {
+			paths = append(paths, name)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ListCommits returns the same commits as the package-level ListCommits.
+func (r *GoGitRepository) ListCommits(ctx context.Context, baseRef, headRef string) ([]Commit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, err := r.commit(headRef)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make(map[plumbing.Hash]bool)
+	if baseRef != EmptyTree {
+		base, err := r.commit(baseRef)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.markAncestors(ctx, base, exclude); err != nil {
+			return nil, err
+		}
+	}
+	return r.newCommits(ctx, head, exclude)
+}
+
+// MergeBase returns the same commit as the package-level MergeBase.
+func (r *GoGitRepository) MergeBase(ctx context.Context, a, b string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	base, err := r.mergeBase(a, b)
+	if err != nil {
+		return "", err
+	}
+	return base.Hash.String(), nil
+}
+
+// NewCommitBase returns the same base as the package-level NewCommitBase.
+func (r *GoGitRepository) NewCommitBase(ctx context.Context, rev string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, err := r.commit(rev)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Like git rev-list --all, HEAD counts as a ref
+	exclude := make(map[plumbing.Hash]bool)
+	refs, err := r.repo.References()
+	if err != nil {
+		return "", false, err
+	}
+	defer refs.Close()
+	var tips []*object.Commit
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		resolved, err := r.repo.Reference(ref.Name(), true)
+		if err != nil {
+			return nil // dangling symbolic ref
+		}
+		if c := r.peelCommit(resolved.Hash()); c != nil {
+			tips = append(tips, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	for _, c := range tips {
+		if err := r.markAncestors(ctx, c, exclude); err != nil {
+			return "", false, err
+		}
+	}
+
+	commits, err := r.newCommits(ctx, head, exclude)
+	if err != nil || len(commits) == 0 {
+		return "", false, err
+	}
+	if len(commits[0].Parents) == 0 {
+		return EmptyTree, true, nil
+	}
+	return commits[0].Parents[0], true, nil
+}
+
+// RepoPath returns the same path as the package-level RepoPath, relative to
+// the directory the repository was opened from.
+func (r *GoGitRepository) RepoPath(ctx context.Context, path string) (string, error) {
+	return filepath.ToSlash(filepath.Join(r.prefix, path)), nil
+}
+
+// WorktreePath returns the same path as the package-level WorktreePath.
+func (r *GoGitRepository) WorktreePath(ctx context.Context, path string) (string, error) {
+	if r.root == "" {
+		return "", errors.New("repository has no working tree")
+	}
+	return filepath.Join(r.root, filepath.FromSlash(path)), nil
+}
+
+// peelCommit returns the commit an object name refers to, directly or
+// through annotated tags, or nil if it does not refer to a commit.
+func (r *GoGitRepository) peelCommit(hash plumbing.Hash) *object.Commit {
+	for {
+		if c, err := r.repo.CommitObject(hash); err == nil {
+			return c
+		}
+		tag, err := r.repo.TagObject(hash)
+		if err != nil {
+			return nil
+		}
+		hash = tag.Target
+	}
+}
+
+// markAncestors adds c and all its ancestors to seen.
+func (r *GoGitRepository) markAncestors(ctx context.Context, c *object.Commit, seen map[plumbing.Hash]bool) error {
+	stack := []plumbing.Hash{c.Hash}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		c, err := r.repo.CommitObject(hash)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, c.ParentHashes...)
+	}
+	return nil
+}
+
+// newCommits returns head and its ancestors that are not in exclude, in the
+// order of git rev-list --topo-order --reverse: every commit comes after its
+// parents, and the history of a first parent before that of later parents.
+func (r *GoGitRepository) newCommits(ctx context.Context, head *object.Commit, exclude map[plumbing.Hash]bool) ([]Commit, error) {
+	if exclude[head.Hash] {
+		return nil, nil
+	}
+
+	// Post-order depth-first walk, first parents first
+	type frame struct {
+		commit *object.Commit
+		next   int // index of the next parent to visit
+	}
+	var commits []Commit
+	visited := map[plumbing.Hash]bool{head.Hash: true}
+	stack := []frame{{commit: head}}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		top := &stack[len(stack)-1]
+		if top.next == len(top.commit.ParentHashes) {
+			c := Commit{SHA: top.commit.Hash.String(), Parents: []string{}}
+			for _, p := range top.commit.ParentHashes {
+				c.Parents = append(c.Parents, p.String())
+			}
+			commits = append(commits, c)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		hash := top.commit.ParentHashes[top.next]
+		top.next++
+		if visited[hash] || exclude[hash] {
+			continue
+		}
+		visited[hash] = true
+		parent, err := r.repo.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, frame{commit: parent})
+	}
+	return commits, nil
+}
+
+// commit resolves a revision to a commit.
+func (r *GoGitRepository) commit(ref string) (*object.Commit, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	return r.repo.CommitObject(*hash)
+}
+
+// tree returns the tree of a commit, caching it by ref. EmptyTree has no
+// entries.
+func (r *GoGitRepository) tree(ref string) (*object.Tree, error) {
+	if tree, ok := r.trees[ref]; ok {
+		return tree, nil
+	}
+	if ref == EmptyTree {
+		return &object.Tree{}, nil
+	}
+	c, err := r.commit(ref)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	r.trees[ref] = tree
+	return tree, nil
+}
+
+// mergeBase returns the best common ancestor of two commits.
+func (r *GoGitRepository) mergeBase(a, b string) (*object.Commit, error) {
+	ca, err := r.commit(a)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := r.commit(b)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := ca.MergeBase(cb)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%s and %s have no merge base", a, b)
+	}
+	return bases[0], nil
+}
+
+func (r *GoGitRepository) blob(hash plumbing.Hash) (string, error) {
+	b, err := r.repo.BlobObject(hash)
+	if err != nil {
+		return "", err
+	}
+	rd, err := b.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// treeFile is a file on one side of a diff.
+type treeFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+	// onDisk is set for working tree files whose content differs from the
+	// index, and so is not in the object database.
+	onDisk bool
+}
+
+// flattenTree returns every file in a tree.
+func flattenTree(tree *object.Tree) (map[string]treeFile, error) {
+	files := make(map[string]treeFile)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode.IsFile() {
+			files[name] = treeFile{path: name, hash: entry.Hash, mode: entry.Mode}
+		}
+	}
+}
+
+// changedFiles returns the files that differ between two trees, on each side.
+func changedFiles(a, b *object.Tree) (map[string]treeFile, map[string]treeFile, error) {
+	changes, err := object.DiffTree(a, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	oldFiles := make(map[string]treeFile)
+	newFiles := make(map[string]treeFile)
+	for _, c := range changes {
+		if c.From.Name != "" && c.From.TreeEntry.Mode.IsFile() {
+			oldFiles[c.From.Name] = treeFile{path: c.From.Name, hash: c.From.TreeEntry.Hash, mode: c.From.TreeEntry.Mode}
+		}
+		if c.To.Name != "" && c.To.TreeEntry.Mode.IsFile() {
+			newFiles[c.To.Name] = treeFile{path: c.To.Name, hash: c.To.TreeEntry.Hash, mode: c.To.TreeEntry.Mode}
+		}
+	}
+	return oldFiles, newFiles, nil
+}
+
+// indexFiles returns the files in the index, or, if worktree is set, the
+// working tree versions of them. A working tree file whose size and
+// modification time match the index is assumed to be unchanged.
+func (r *GoGitRepository) indexFiles(worktree bool) (map[string]treeFile, error) {
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	if worktree && r.root == "" {
+		return nil, errors.New("repository has no working tree")
+	}
+
+	files := make(map[string]treeFile)
+	for _, e := range idx.Entries {
+		// Unmerged entries have a non-zero stage. index.Merged is not 0,
+		// so it cannot be used here.
+		if e.Stage != 0 || !e.Mode.IsFile() {
+			continue
+		}
+		f := treeFile{path: e.Name, hash: e.Hash, mode: e.Mode}
+		if worktree {
+			info, err := os.Lstat(filepath.Join(r.root, filepath.FromSlash(e.Name)))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if int64(e.Size) != info.Size() || !e.ModifiedAt.Equal(info.ModTime()) {
+				if f, err = r.diskFile(e.Name, info); err != nil {
+					return nil, err
+				}
+			}
+		}
+		files[e.Name] = f
+	}
+	return files, nil
+}
+
+// diskFile hashes a working tree file.
+func (r *GoGitRepository) diskFile(path string, info os.FileInfo) (treeFile, error) {
+	f := treeFile{path: path, mode: filemode.Regular, onDisk: true}
+	content, err := r.diskContent(path, info.Mode()&os.ModeSymlink != 0)
+	if err != nil {
+		return f, err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		f.mode = filemode.Symlink
+	case info.Mode()&0o111 != 0:
+		f.mode = filemode.Executable
+	}
+	f.hash = plumbing.ComputeHash(plumbing.BlobObject, []byte(content))
+	return f, nil
+}
+
+// diskContent reads a working tree file as git stores it: a symlink is
+// stored as its target.
+func (r *GoGitRepository) diskContent(path string, symlink bool) (string, error) {
+	fullPath := filepath.Join(r.root, filepath.FromSlash(path))
+	if symlink {
+		target, err := os.Readlink(fullPath)
+		return filepath.ToSlash(target), err
+	}
+	data, err := os.ReadFile(fullPath)
+	return string(data), err
+}
+
+// content returns the content of a file on one side of a diff.
+func (r *GoGitRepository) content(f *treeFile) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	if f.onDisk {
+		return r.diskContent(f.path, f.mode == filemode.Symlink)
+	}
+	return r.blob(f.hash)
+}
+
+// pathSpecs converts paths relative to the directory the repository was
+// opened from into repository paths. Nil means all files.
+func (r *GoGitRepository) pathSpecs(paths []string) []string {
+	var specs []string
+	for _, p := range paths {
+		spec := filepath.ToSlash(filepath.Join(r.prefix, p))
+		if spec == "." {
+			return nil
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// filterSpecs returns the files that are, or are inside, one of the specs.
+func filterSpecs(files map[string]treeFile, specs []string) map[string]treeFile {
+	if specs == nil {
+		return files
+	}
+	filtered := make(map[string]treeFile)
+	for path, f := range files {
+		for _, spec := range specs {
+			if path == spec || strings.HasPrefix(path, spec+"/") {
+				filtered[path] = f
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// fileChange is a changed file. From is nil for an added file and To for a
+// deleted one.
+type fileChange struct {
+	From, To   *treeFile
+	similarity int // for renames
+}
+
+func (c fileChange) path() string {
+	if c.To != nil {
+		return c.To.path
+	}
+	return c.From.path
+}
+
+// compareFiles returns the files that were added, deleted or modified,
+// ordered by path.
+func compareFiles(oldFiles, newFiles map[string]treeFile) []fileChange {
+	var changes []fileChange
+	for path, o := range oldFiles {
+		n, ok := newFiles[path]
+		switch {
+		case !ok:
+			changes = append(changes, fileChange{From: &o})
+		case n.hash != o.hash || n.mode != o.mode:
+			changes = append(changes, fileChange{From: &o, To: &n})
+		}
+	}
+	for path, n := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			changes = append(changes, fileChange{To: &n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path() < changes[j].path()
+	})
+	return changes
+}
+
+// detectRenames pairs deleted and added files into renames: identical files
+// first, then the most similar pairs with at least renameScore similarity.
+func (r *GoGitRepository) detectRenames(ctx context.Context, changes []fileChange) ([]fileChange, error) {
+	var deleted, added []int
+	for i, c := range changes {
+		switch {
+		case c.To == nil:
+			deleted = append(deleted, i)
+		case c.From == nil:
+			added = append(added, i)
+		}
+	}
+	if len(deleted) == 0 || len(added) == 0 {
+		return changes, nil
+	}
+
+	type pair struct{ from, to, score int }
+	var pairs []pair
+	for _, d := range deleted {
+		for _, a := range added {
+			if changes[d].From.hash == changes[a].To.hash {
+				pairs = append(pairs, pair{d, a, 100})
+			}
+		}
+	}
+	if len(deleted) <= renameLimit && len(added) <= renameLimit {
+		contents := make(map[int]string)
+		for _, i := range append(append([]int{}, deleted...), added...) {
+			f := changes[i].From
+			if f == nil {
+				f = changes[i].To
+			}
+			content, err := r.content(f)
+			if err != nil {
+				return nil, err
+			}
+			contents[i] = content
+		}
+		for _, d := range deleted {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			for _, a := range added {
+				if changes[d].From.hash == changes[a].To.hash {
+					continue
+				}
+				if score := similarity(contents[d], contents[a]); score >= renameScore {
+					pairs = append(pairs, pair{d, a, score})
+				}
+			}
+		}
+	}
+	// Stable, so that equal scores keep path order
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].score > pairs[j].score
+	})
+
+	used := make(map[int]bool)
+	for _, p := range pairs {
+		if used[p.from] || used[p.to] {
+			continue
+		}
+		used[p.from] = true
+		used[p.to] = true
+		changes[p.to].From = changes[p.from].From
+		changes[p.to].similarity = p.score
+	}
+
+	var result []fileChange
+	for i, c := range changes {
+		if c.To == nil && used[i] {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// similarity returns the percentage of the larger file made up of lines the
+// two files have in common. Empty files are never similar.
+func similarity(a, b string) int {
+	if a == "" || b == "" {
+		return 0
+	}
+	counts := make(map[string]int)
+	for _, line := range strings.SplitAfter(a, "\n") {
+		counts[line]++
+	}
+	common := 0
+	for _, line := range strings.SplitAfter(b, "\n") {
+		if counts[line] > 0 {
+			counts[line]--
+			common += len(line)
+		}
+	}
+	return common * 100 / max(len(a), len(b))
+}
+
+// writeFileDiff writes the diff of one file in the format of git diff -U0.
+func (r *GoGitRepository) writeFileDiff(w *bytes.Buffer, c fileChange) error {
+	oldName, newName := "/dev/null", "/dev/null"
+	if c.From != nil {
+		oldName = "a/" + c.From.path
+	}
+	if c.To != nil {
+		newName = "b/" + c.To.path
+	}
+
+	gitOld, gitNew := "a/"+c.path(), "b/"+c.path()
+	if c.From != nil {
+		gitOld = oldName
+	}
+	fmt.Fprintf(w, "diff --git %s %s\n", gitOld, gitNew)
+	switch {
+	case c.From == nil:
+		fmt.Fprintf(w, "new file mode %06o\n", uint32(c.To.mode))
+	case c.To == nil:
+		fmt.Fprintf(w, "deleted file mode %06o\n", uint32(c.From.mode))
+	default:
+		if c.From.mode != c.To.mode {
+			fmt.Fprintf(w, "old mode %06o\nnew mode %06o\n", uint32(c.From.mode), uint32(c.To.mode))
+		}
+		if c.From.path != c.To.path {
+			fmt.Fprintf(w, "similarity index %d%%\nrename from %s\nrename to %s\n", c.similarity, c.From.path, c.To.path)
+		}
+	}
+	if c.From != nil && c.To != nil && c.From.hash == c.To.hash {
+		return nil
+	}
+
+	oldHash, newHash := ZeroSHA, ZeroSHA
+	if c.From != nil {
+		oldHash = c.From.hash.String()
+	}
+	if c.To != nil {
+		newHash = c.To.hash.String()
+	}
+	fmt.Fprintf(w, "index %s..%s", oldHash[:7], newHash[:7])
+	if c.From != nil && c.To != nil && c.From.mode == c.To.mode {
+		fmt.Fprintf(w, " %06o", uint32(c.To.mode))
+	}
+	w.WriteString("\n")
+
+	oldContent, err := r.content(c.From)
+	if err != nil {
+		return err
+	}
+	newContent, err := r.content(c.To)
+	if err != nil {
+		return err
+	}
+	if isBinary(oldContent) || isBinary(newContent) {
+		fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+		return nil
+	}
+
+	oldLines, newLines := diff.SplitLines(oldContent), diff.SplitLines(newContent)
+	hunks := lineHunks(oldLines, newLines, !strings.HasSuffix(oldContent, "\n"), !strings.HasSuffix(newContent, "\n"))
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", diffName(oldName), diffName(newName))
+	for _, h := range hunks {
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		writeHunkLines(w, "-", oldLines, h.OldStart, h.OldLines, !strings.HasSuffix(oldContent, "\n"))
+		writeHunkLines(w, "+", newLines, h.NewStart, h.NewLines, !strings.HasSuffix(newContent, "\n"))
+	}
+	return nil
+}
+
+// lineHunks returns the hunks that turn a into b. A last line without a
+// newline differs from the same line with one, as in git. The common prefix
+// and suffix are skipped before diffing.
+func lineHunks(a, b []string, aNoEOL, bNoEOL bool) []diff.Hunk {
+	a, b = eolLines(a, aNoEOL), eolLines(b, bNoEOL)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	hunks := diff.Lines(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for i := range hunks {
+		hunks[i].OldStart += prefix
+		hunks[i].NewStart += prefix
+	}
+	return hunks
+}
+
+// eolLines marks the last line if it has no newline.
+func eolLines(lines []string, noEOL bool) []string {
+	if !noEOL || len(lines) == 0 {
+		return lines
+	}
+	marked := append([]string{}, lines...)
+	marked[len(marked)-1] += "\x00"
+	return marked
+}
+
+func writeHunkLines(w *bytes.Buffer, prefix string, lines []string, start, count int, noEOL bool) {
+	for i := start; i < start+count; i++ {
+		fmt.Fprintf(w, "%s%s\n", prefix, lines[i-1])
+		if noEOL && i == len(lines) {
+			w.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a hunk range as git does, omitting a count of 1.
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffName terminates a name containing spaces with a tab, as git does, so
+// that it can be parsed.
+func diffName(name string) string {
+	if strings.Contains(name, " ") {
+		return name + "\t"
+	}
+	return name
+}
+
+// isBinary reports whether content looks binary to git: it has a NUL byte
+// in its first 8000 bytes.
+func isBinary(content string) bool {
+	return strings.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// relativePrefix returns dir relative to root, slash-separated, or an empty
+// string if they are the same directory.
+func relativePrefix(root, dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, absDir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
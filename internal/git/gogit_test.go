@@ -0,0 +1,262 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+func setupRepo(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	run(t, dir, "init", "-b", "main")
+	run(t, dir, "config", "user.email", "test@test.com")
+	run(t, dir, "config", "user.name", "Test")
+	return dir
+}
+
+func run(t testing.TB, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func write(t testing.TB, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupChanges creates a main branch and a feature branch with every kind
+// of change the diff has to describe.
+func setupChanges(t *testing.T) string {
+	dir := setupRepo(t)
+	write(t, dir, "app.rb", "line 1\n# START\nold\n# END\nline 5\n")
+	write(t, dir, "deleted.rb", "gone 1\ngone 2\n")
+	write(t, dir, "moved.rb", "a\nb\nc\nd\ne\nf\ng\nh\n")
+	write(t, dir, "same.rb", "same content\n")
+	write(t, dir, "noeol.rb", "x\ny")
+	write(t, dir, "script.sh", "echo hi\n")
+	write(t, dir, "lib/nested.rb", "one\ntwo\nthree\n")
+	write(t, dir, "data.bin", "a\x00b")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", "base")
+
+	run(t, dir, "checkout", "-b", "feature")
+	write(t, dir, "app.rb", "line 1\n# START\nnew\nadded\n# END\nline 5 changed\n")
+	os.Remove(filepath.Join(dir, "deleted.rb"))
+	os.Remove(filepath.Join(dir, "moved.rb"))
+	write(t, dir, "renamed.rb", "a\nb\nc\nd\nE\nf\ng\nh\n")
+	os.Remove(filepath.Join(dir, "same.rb"))
+	write(t, dir, "same2.rb", "same content\n")
+	write(t, dir, "noeol.rb", "x\ny\n")
+	write(t, dir, "new.rb", "brand\nnew\n")
+	write(t, dir, "empty.rb", "")
+	write(t, dir, "lib/nested.rb", "one\n2\nthree\nfour\n")
+	write(t, dir, "data.bin", "a\x00c")
+	run(t, dir, "add", "-A")
+	run(t, dir, "update-index", "--chmod=+x", "script.sh")
+	run(t, dir, "commit", "-m", "changes")
+	return dir
+}
+
+func parsedDiffs(t *testing.T, repo Repository, base, head string, paths []string) []diff.FileDiff {
+	t.Helper()
+	out, err := repo.GetDiff(t.Context(), base, head, paths)
+	if err != nil {
+		t.Fatalf("GetDiff(%s, %s) failed: %v", base, head, err)
+	}
+	fds, err := diff.Parse(out)
+	if err != nil {
+		t.Fatalf("failed to parse diff: %v\n%s", err, out)
+	}
+	return fds
+}
+
+func assertSameDiff(t *testing.T, dir, base, head string, paths []string) {
+	t.Helper()
+	repo, err := OpenGoGit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := parsedDiffs(t, ExecRepository{}, base, head, paths)
+	got := parsedDiffs(t, repo, base, head, paths)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff %s %s %v:\nexpected %+v\ngot      %+v", base, head, paths, want, got)
+	}
+}
+
+func chdir(t testing.TB, dir string) {
+	t.Helper()
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(origDir) })
+}
+
+func TestGoGit_GetDiff_Commits(t *testing.T) {
+	dir := setupChanges(t)
+	chdir(t, dir)
+
+	assertSameDiff(t, dir, "main", "HEAD", nil)
+	assertSameDiff(t, dir, "main", "feature", []string{"lib", "app.rb"})
+	assertSameDiff(t, dir, "HEAD", "main", nil)
+	assertSameDiff(t, dir, EmptyTree, "HEAD", nil)
+}
+
+func TestGoGit_GetDiff_Subdirectory(t *testing.T) {
+	dir := setupChanges(t)
+	chdir(t, filepath.Join(dir, "lib"))
+
+	assertSameDiff(t, ".", "main", "HEAD", []string{"nested.rb"})
+	assertSameDiff(t, ".", "main", "HEAD", []string{"."})
+}
+
+func TestGoGit_GetDiff_StagedAndWorktree(t *testing.T) {
+	dir := setupChanges(t)
+	chdir(t, dir)
+
+	write(t, dir, "app.rb", "line 1\n# START\nstaged\n# END\nline 5 changed\n")
+	write(t, dir, "staged.rb", "staged file\n")
+	run(t, dir, "add", "-A")
+	write(t, dir, "app.rb", "line 1\n# START\nin the working tree\n# END\nline 5 changed\n")
+	os.Remove(filepath.Join(dir, "new.rb"))
+	write(t, dir, "untracked.rb", "not in the diff\n")
+
+	assertSameDiff(t, dir, "main", StagedRef, nil)
+	assertSameDiff(t, dir, "main", WorktreeRef, nil)
+	assertSameDiff(t, dir, EmptyTree, StagedRef, nil)
+}
+
+func TestGoGit_GetFileContent(t *testing.T) {
+	dir := setupChanges(t)
+	chdir(t, dir)
+	write(t, dir, "app.rb", "worktree\n")
+
+	repo, err := OpenGoGit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"main", "HEAD", "HEAD~1", StagedRef, WorktreeRef, EmptyTree} {
+		for _, path := range []string{"app.rb", "lib/nested.rb", "moved.rb", "missing.rb"} {
+			wantContent, wantExists, wantErr := GetFileContent(t.Context(), ref, path)
+			content, exists, err := repo.GetFileContent(t.Context(), ref, path)
+			if (err != nil) != (wantErr != nil) || exists != wantExists || content != wantContent {
+				t.Errorf("%s:%s: expected (%q, %v, %v), got (%q, %v, %v)",
+					ref, path, wantContent, wantExists, wantErr, content, exists, err)
+			}
+		}
+	}
+}
+
+func TestGoGit_UnknownRef(t *testing.T) {
+	dir := setupChanges(t)
+	repo, err := OpenGoGit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetDiff(t.Context(), "no-such-ref", "HEAD", nil); err == nil {
+		t.Error("expected error for unknown ref")
+	}
+	if _, _, err := repo.GetFileContent(t.Context(), "no-such-ref", "app.rb"); err == nil {
+		t.Error("expected error for unknown ref")
+	}
+}
+
+// setupHistory creates a feature branch with a side branch merged into it,
+// and commits that no ref points to, as in a push being received.
+func setupHistory(t *testing.T) (dir, unreferenced string) {
+	dir = setupRepo(t)
+	write(t, dir, "app.rb", "app\n")
+	write(t, dir, "lib/nested.rb", "nested\n")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", "base")
+	run(t, dir, "checkout", "-b", "feature")
+	write(t, dir, "lib/nested.rb", "changed\n")
+	run(t, dir, "commit", "-am", "change")
+
+	run(t, dir, "checkout", "-b", "side", "main")
+	write(t, dir, "side.rb", "side\n")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", "side")
+	run(t, dir, "checkout", "feature")
+	write(t, dir, "more.rb", "more\n")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", "more")
+	run(t, dir, "merge", "--no-ff", "-m", "merge side", "side")
+	run(t, dir, "tag", "-a", "-m", "annotated", "v1", "main")
+
+	run(t, dir, "checkout", "-b", "pushed")
+	write(t, dir, "pushed.rb", "pushed\n")
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", "pushed 1")
+	write(t, dir, "pushed.rb", "pushed again\n")
+	run(t, dir, "commit", "-am", "pushed 2")
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, dir, "checkout", "feature")
+	run(t, dir, "branch", "-D", "pushed")
+	return dir, strings.TrimSpace(string(out))
+}
+
+func TestGoGit_History(t *testing.T) {
+	dir, unreferenced := setupHistory(t)
+	chdir(t, filepath.Join(dir, "lib"))
+
+	repo, err := OpenGoGit(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := ExecRepository{}
+	same := func(what string, want, got any, wantErr, gotErr error) {
+		t.Helper()
+		if (gotErr != nil) != (wantErr != nil) || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected (%v, %v), got (%v, %v)", what, want, wantErr, got, gotErr)
+		}
+	}
+
+	for _, ref := range []string{"main", "feature", "HEAD~1", "v1", StagedRef, WorktreeRef, "no-such-ref"} {
+		want, wantErr := exec.ListFiles(t.Context(), ref)
+		got, err := repo.ListFiles(t.Context(), ref)
+		same("ListFiles "+ref, want, got, wantErr, err)
+	}
+	for _, revs := range [][2]string{{"main", "feature"}, {"side", "feature"}, {"feature", "main"}, {EmptyTree, "side"}, {"v1", unreferenced}} {
+		want, wantErr := exec.ListCommits(t.Context(), revs[0], revs[1])
+		got, err := repo.ListCommits(t.Context(), revs[0], revs[1])
+		same("ListCommits "+revs[0]+" "+revs[1], want, got, wantErr, err)
+	}
+	for _, revs := range [][2]string{{"main", "feature"}, {"side", "feature"}, {"v1", unreferenced}} {
+		want, wantErr := exec.MergeBase(t.Context(), revs[0], revs[1])
+		got, err := repo.MergeBase(t.Context(), revs[0], revs[1])
+		same("MergeBase "+revs[0]+" "+revs[1], want, got, wantErr, err)
+	}
+	for _, rev := range []string{unreferenced, "feature"} {
+		want, wantOK, wantErr := exec.NewCommitBase(t.Context(), rev)
+		got, ok, err := repo.NewCommitBase(t.Context(), rev)
+		same("NewCommitBase "+rev, []any{want, wantOK}, []any{got, ok}, wantErr, err)
+	}
+	for _, path := range []string{"nested.rb", "../app.rb", "."} {
+		want, wantErr := exec.RepoPath(t.Context(), path)
+		got, err := repo.RepoPath(t.Context(), path)
+		same("RepoPath "+path, want, got, wantErr, err)
+	}
+	want, wantErr := exec.WorktreePath(t.Context(), "lib/nested.rb")
+	got, err := repo.WorktreePath(t.Context(), "lib/nested.rb")
+	same("WorktreePath", want, got, wantErr, err)
+}
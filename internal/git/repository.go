@@ -0,0 +1,107 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Repository provides the diffs, file contents and history the commands
+// need. Each method behaves like the package-level function of the same
+// name, and gives up on its work once ctx is done.
+type Repository interface {
+	// GetDiff returns the -U0 unified diff between the merge base of the
+	// refs and headRef, limited to paths if any are given.
+	GetDiff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error)
+	// GetFileContent returns the content of a file at a ref, and whether
+	// the file exists.
+	GetFileContent(ctx context.Context, ref, path string) (string, bool, error)
+	// ListFiles returns the paths of all tracked files at a ref.
+	ListFiles(ctx context.Context, ref string) ([]string, error)
+	// ListCommits returns the commits in base..head, oldest first.
+	ListCommits(ctx context.Context, baseRef, headRef string) ([]Commit, error)
+	// MergeBase returns the best common ancestor of two commits.
+	MergeBase(ctx context.Context, a, b string) (string, error)
+	// NewCommitBase returns the base to validate the commits reachable from
+	// rev but not from any ref against.
+	NewCommitBase(ctx context.Context, rev string) (string, bool, error)
+	// RepoPath converts a path relative to the current directory into a
+	// path relative to the repository root.
+	RepoPath(ctx context.Context, path string) (string, error)
+	// WorktreePath converts a path relative to the repository root into a
+	// path in the working tree.
+	WorktreePath(ctx context.Context, path string) (string, error)
+}
+
+// Names of the repository backends accepted by Open.
+const (
+	// BackendExec runs the git command for every request.
+	BackendExec = "exec"
+	// BackendBatch runs the git command for diffs and reads files through
+	// one git cat-file --batch process.
+	BackendBatch = "batch"
+	// BackendGoGit reads objects and computes diffs in process.
+	BackendGoGit = "go-git"
+)
+
+// Backends returns the names accepted by Open.
+func Backends() []string {
+	return []string{BackendExec, BackendBatch, BackendGoGit}
+}
+
+// Open returns the repository containing the current directory, accessed
+// through the named backend.
+func Open(backend string) (Repository, error) {
+	switch backend {
+	case BackendExec:
+		return ExecRepository{}, nil
+	case BackendBatch:
+		return NewBatchRepository(), nil
+	case BackendGoGit:
+		return OpenGoGit(".")
+	}
+	return nil, fmt.Errorf("unknown backend %q (want %s)", backend, strings.Join(Backends(), ", "))
+}
+
+// ExecRepository implements Repository by running the git command.
+type ExecRepository struct{}
+
+// GetDiff calls the package-level GetDiff.
+func (ExecRepository) GetDiff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error) {
+	return GetDiff(ctx, baseRef, headRef, paths)
+}
+
+// GetFileContent calls the package-level GetFileContent.
+func (ExecRepository) GetFileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	return GetFileContent(ctx, ref, path)
+}
+
+// ListFiles calls the package-level ListFiles.
+func (ExecRepository) ListFiles(ctx context.Context, ref string) ([]string, error) {
+	return ListFiles(ctx, ref)
+}
+
+// ListCommits calls the package-level ListCommits.
+func (ExecRepository) ListCommits(ctx context.Context, baseRef, headRef string) ([]Commit, error) {
+	return ListCommits(ctx, baseRef, headRef)
+}
+
+// MergeBase calls the package-level MergeBase.
+func (ExecRepository) MergeBase(ctx context.Context, a, b string) (string, error) {
+	return MergeBase(ctx, a, b)
+}
+
+// NewCommitBase calls the package-level NewCommitBase.
+func (ExecRepository) NewCommitBase(ctx context.Context, rev string) (string, bool, error) {
+	return NewCommitBase(ctx, rev)
+}
+
+// RepoPath calls the package-level RepoPath.
+func (ExecRepository) RepoPath(ctx context.Context, path string) (string, error) {
+	return RepoPath(ctx, path)
+}
+
+// WorktreePath calls the package-level WorktreePath.
+func (ExecRepository) WorktreePath(ctx context.Context, path string) (string, error) {
+	return WorktreePath(ctx, path)
+}
@@ -0,0 +1,143 @@
+package hook
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/output"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// Update represents a single ref update as passed to a pre-receive or update hook.
+type Update struct {
+	OldRev  string
+	NewRev  string
+	RefName string
+}
+
+// IsCreate returns true if the update creates a new ref.
+func (u Update) IsCreate() bool {
+	return git.IsZeroSHA(u.OldRev)
+}
+
+// IsDelete returns true if the update deletes an existing ref.
+func (u Update) IsDelete() bool {
+	return git.IsZeroSHA(u.NewRev)
+}
+
+// RefResult represents the validation result for a single ref update.
+type RefResult struct {
+	Update     Update
+	Result     *sandwich.Result
+	SkipReason string
+	Err        error
+}
+
+// Success returns true if the update should be accepted.
+func (r RefResult) Success() bool {
+	if r.Err != nil {
+		return false
+	}
+	return r.Result == nil || r.Result.Success
+}
+
+// ParseUpdates reads "<old> <new> <ref>" lines in the pre-receive hook format.
+// Blank lines are ignored.
+func ParseUpdates(r io.Reader) ([]Update, error) {
+	var updates []Update
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed update at line %d: %q", lineNum, line)
+		}
+		updates = append(updates, Update{OldRev: fields[0], NewRev: fields[1], RefName: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading updates: %w", err)
+	}
+	return updates, nil
+}
+
+// Check validates each update against the config returned by config for the
+// base of the update, with BaseRef and HeadRef replaced by the base and the
+// new revision. Bases are resolved in repo.
+//
+// Deleted refs are skipped. The base of an update is its old revision. For
+// created refs, the base is the parent of the oldest commit that does not
+// exist on the server yet, or the empty tree if that commit has no parent.
+func Check(ctx context.Context, repo git.Repository, config func(base string) (*sandwich.Config, error), updates []Update) []RefResult {
+	var results []RefResult
+	for _, u := range updates {
+		results = append(results, checkUpdate(ctx, repo, config, u))
+	}
+	return results
+}
+
+func checkUpdate(ctx context.Context, repo git.Repository, config func(base string) (*sandwich.Config, error), u Update) RefResult {
+	rr := RefResult{Update: u}
+
+	if u.IsDelete() {
+		rr.SkipReason = "ref deleted"
+		return rr
+	}
+
+	base := u.OldRev
+	if u.IsCreate() {
+		parent, ok, err := repo.NewCommitBase(ctx, u.NewRev)
+		if err != nil {
+			rr.Err = fmt.Errorf("failed to find new commits: %w", err)
+			return rr
+		}
+		if !ok {
+			rr.SkipReason = "no new commits"
+			return rr
+		}
+		base = parent
+	}
+
+	cfg, err := config(base)
+	if err != nil {
+		rr.Err = err
+		return rr
+	}
+	refCfg := *cfg
+	refCfg.BaseRef = base
+	refCfg.HeadRef = u.NewRev
+
+	result, err := sandwich.Validate(ctx, &refCfg)
+	if err != nil {
+		rr.Err = err
+		return rr
+	}
+	rr.Result = result
+	return rr
+}
+
+// Report writes one status line per ref followed by the details of any
+// rejected files. Git relays hook output to the pusher prefixed with "remote:".
+func Report(w io.Writer, results []RefResult) {
+	for _, rr := range results {
+		switch {
+		case rr.Err != nil:
+			fmt.Fprintf(w, "git-sandwich: %s: error: %v\n", rr.Update.RefName, rr.Err)
+		case rr.SkipReason != "":
+			fmt.Fprintf(w, "git-sandwich: %s: skipped (%s)\n", rr.Update.RefName, rr.SkipReason)
+		case rr.Success():
+			fmt.Fprintf(w, "git-sandwich: %s: ok\n", rr.Update.RefName)
+		default:
+			fmt.Fprintf(w, "git-sandwich: %s: rejected\n", rr.Update.RefName)
+			output.FormatText(w, rr.Result)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// TestMain runs the test binary as a pre-receive hook when
+// SANDWICH_TEST_PRE_RECEIVE names a backend, so that pushes can be tested.
+func TestMain(m *testing.M) {
+	if backend := os.Getenv("SANDWICH_TEST_PRE_RECEIVE"); backend != "" {
+		os.Exit(preReceive(backend))
+	}
+	os.Exit(m.Run())
+}
+
+func preReceive(backend string) int {
+	repo, err := git.Open(backend)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	updates, err := ParseUpdates(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cfg := &sandwich.Config{
+		StartMarkerRegex: regexp.MustCompile(`# START`),
+		EndMarkerRegex:   regexp.MustCompile(`# END`),
+		Repository:       repo,
+	}
+	results := Check(context.Background(), cfg.Repo(), configOf(cfg), updates)
+	Report(os.Stderr, results)
+	for _, rr := range results {
+		if !rr.Success() {
+			return 1
+		}
+	}
+	return 0
+}
+
+func TestParseUpdates(t *testing.T) {
+	input := "aaa bbb refs/heads/main\n\n" + git.ZeroSHA + " ccc refs/heads/feature\n"
+	updates, err := ParseUpdates(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(updates))
+	}
+	if updates[0].OldRev != "aaa" || updates[0].NewRev != "bbb" || updates[0].RefName != "refs/heads/main" {
+		t.Errorf("unexpected update[0]: %+v", updates[0])
+	}
+	if !updates[1].IsCreate() || updates[1].IsDelete() {
+		t.Errorf("expected update[1] to be a create, got %+v", updates[1])
+	}
+}
+
+func TestParseUpdates_Malformed(t *testing.T) {
+	_, err := ParseUpdates(strings.NewReader("aaa bbb\n"))
+	if err == nil {
+		t.Fatal("expected error for malformed line")
+	}
+}
+
+func TestIsZeroSHA(t *testing.T) {
+	if !git.IsZeroSHA(git.ZeroSHA) {
+		t.Error("expected ZeroSHA to be zero")
+	}
+	if !git.IsZeroSHA(strings.Repeat("0", 64)) {
+		t.Error("expected SHA-256 zero name to be zero")
+	}
+	if git.IsZeroSHA("") || git.IsZeroSHA("0a00") {
+		t.Error("expected non-zero names to be rejected")
+	}
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@test.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@test.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeAndCommit(t *testing.T, dir, name, content, msg string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-m", msg)
+	return run(t, dir, "rev-parse", "HEAD")
+}
+
+// configOf returns the config function of Check for one config used for
+// every update.
+func configOf(cfg *sandwich.Config) func(string) (*sandwich.Config, error) {
+	return func(string) (*sandwich.Config, error) {
+		return cfg, nil
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	run(t, dir, "init")
+	run(t, dir, "checkout", "-b", "main")
+	base := writeAndCommit(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n", "base")
+
+	// Commits that are not reachable from any ref, as in a pre-receive quarantine
+	run(t, dir, "checkout", "--detach")
+	inside := writeAndCommit(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n", "inside")
+	outside := writeAndCommit(t, dir, "app.rb", "CHANGED\n# START\nmodified\n# END\nline 5\n", "outside")
+	run(t, dir, "checkout", "--orphan", "orphan")
+	orphan := writeAndCommit(t, dir, "app.rb", "line 1\n# START\nunclosed\n", "orphan")
+	run(t, dir, "checkout", "-f", "main")
+	run(t, dir, "branch", "-D", "orphan")
+
+	cfg := &sandwich.Config{
+		StartMarkerRegex: regexp.MustCompile(`# START`),
+		EndMarkerRegex:   regexp.MustCompile(`# END`),
+	}
+
+	updates := []Update{
+		{OldRev: base, NewRev: inside, RefName: "refs/heads/main"},
+		{OldRev: inside, NewRev: outside, RefName: "refs/heads/bad"},
+		{OldRev: git.ZeroSHA, NewRev: outside, RefName: "refs/heads/new"},
+		{OldRev: git.ZeroSHA, NewRev: base, RefName: "refs/heads/same"},
+		{OldRev: base, NewRev: git.ZeroSHA, RefName: "refs/heads/gone"},
+		{OldRev: git.ZeroSHA, NewRev: orphan, RefName: "refs/heads/orphan"},
+	}
+	var bases []string
+	config := func(base string) (*sandwich.Config, error) {
+		bases = append(bases, base)
+		return cfg, nil
+	}
+	results := Check(t.Context(), cfg.Repo(), config, updates)
+	if len(results) != len(updates) {
+		t.Fatalf("expected %d results, got %d", len(updates), len(results))
+	}
+	// Configs are only needed for the updates that are validated
+	if want := []string{base, inside, base, git.EmptyTree}; !slices.Equal(bases, want) {
+		t.Errorf("expected configs for bases %v, got %v", want, bases)
+	}
+
+	if !results[0].Success() {
+		t.Errorf("expected inside change to pass, got %+v", results[0])
+	}
+	if results[1].Success() {
+		t.Errorf("expected outside change to be rejected, got %+v", results[1])
+	}
+	if results[2].Success() {
+		t.Errorf("expected new branch with outside change to be rejected, got %+v", results[2])
+	}
+	if !results[3].Success() || results[3].SkipReason == "" {
+		t.Errorf("expected new branch without new commits to be skipped, got %+v", results[3])
+	}
+	if !results[4].Success() || results[4].SkipReason != "ref deleted" {
+		t.Errorf("expected deletion to be skipped, got %+v", results[4])
+	}
+	if results[5].Success() || results[5].SkipReason != "" {
+		t.Errorf("expected orphan branch with broken block to be rejected, got %+v", results[5])
+	}
+
+	perCommit := *cfg
+	perCommit.PerCommit = true
+	if rr := checkUpdate(t.Context(), perCommit.Repo(), configOf(&perCommit), updates[5]); rr.Success() {
+		t.Errorf("expected orphan branch to be rejected per commit, got %+v", rr)
+	}
+
+	var buf bytes.Buffer
+	Report(&buf, results)
+	out := buf.String()
+	if !strings.Contains(out, "git-sandwich: refs/heads/main: ok") {
+		t.Errorf("expected ok line, got %q", out)
+	}
+	if !strings.Contains(out, "git-sandwich: refs/heads/bad: rejected") {
+		t.Errorf("expected rejected line, got %q", out)
+	}
+	if !strings.Contains(out, "FAIL app.rb") {
+		t.Errorf("expected file details, got %q", out)
+	}
+	if !strings.Contains(out, "git-sandwich: refs/heads/gone: skipped (ref deleted)") {
+		t.Errorf("expected skipped line, got %q", out)
+	}
+
+	// The go-git backend finds the new commits without the git command
+	repo, err := git.Open(git.BackendGoGit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", "")
+	goGit := *cfg
+	goGit.Repository = repo
+	for i, rr := range Check(t.Context(), goGit.Repo(), configOf(&goGit), updates) {
+		if rr.Err != nil || rr.Success() != results[i].Success() || rr.SkipReason != results[i].SkipReason {
+			t.Errorf("go-git: %s: expected %+v, got %+v", rr.Update.RefName, results[i], rr)
+		}
+	}
+}
+
+func TestCheck_BareRepository(t *testing.T) {
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := t.TempDir()
+	run(t, server, "init", "--bare", "-b", "main")
+	hookScript := "#!/bin/sh\nexec " + bin + " -test.run '^$'\n"
+	if err := os.WriteFile(filepath.Join(server, "hooks", "pre-receive"), []byte(hookScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	run(t, dir, "init", "-b", "main")
+	writeAndCommit(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n", "base")
+	run(t, dir, "remote", "add", "origin", server)
+
+	push := func(backend, ref string) (string, error) {
+		cmd := exec.Command("git", "push", "origin", ref)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "SANDWICH_TEST_PRE_RECEIVE="+backend)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// New objects are quarantined until the hook accepts them
+	for _, backend := range []string{git.BackendExec, git.BackendBatch} {
+		run(t, dir, "checkout", "-b", backend, "main")
+		writeAndCommit(t, dir, "app.rb", "line 1\n# START\n"+backend+"\n# END\nline 5\n", "inside")
+		if out, err := push(backend, backend); err != nil {
+			t.Errorf("%s: expected push to be accepted, got %v\n%s", backend, err, out)
+		}
+		writeAndCommit(t, dir, "app.rb", "CHANGED\n# START\n"+backend+"\n# END\nline 5\n", "outside")
+		if out, err := push(backend, backend); err == nil || !strings.Contains(out, "rejected") {
+			t.Errorf("%s: expected push to be rejected, got %v\n%s", backend, err, out)
+		}
+	}
+
+	out, err := push(git.BackendGoGit, "main")
+	if err == nil || !strings.Contains(out, "GIT_OBJECT_DIRECTORY") {
+		t.Errorf("go-git: expected the backend to be refused, got %v\n%s", err, out)
+	}
+
+	// Outside a hook, go-git opens the bare repository
+	origDir, _ := os.Getwd()
+	os.Chdir(server)
+	defer os.Chdir(origDir)
+	repo, err := git.Open(git.BackendGoGit)
+	if err != nil {
+		t.Fatalf("go-git: failed to open bare repository: %v", err)
+	}
+	if files, err := repo.ListFiles(t.Context(), "exec"); err != nil || len(files) != 1 || files[0] != "app.rb" {
+		t.Errorf("go-git: expected app.rb in the bare repository, got %v (err=%v)", files, err)
+	}
+	head := run(t, server, "rev-parse", "exec")
+	cfg := &sandwich.Config{
+		StartMarkerRegex: regexp.MustCompile(`# START`),
+		EndMarkerRegex:   regexp.MustCompile(`# END`),
+		Repository:       repo,
+	}
+	if rr := checkUpdate(t.Context(), cfg.Repo(), configOf(cfg), Update{OldRev: git.ZeroSHA, NewRev: head, RefName: "refs/heads/copy"}); !rr.Success() || rr.SkipReason != "no new commits" {
+		t.Errorf("go-git: expected pushed commits to be known, got %+v", rr)
+	}
+}
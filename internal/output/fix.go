@@ -0,0 +1,19 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// FormatFixRefusals writes the files that fix could not revert.
+func FormatFixRefusals(w io.Writer, refused []sandwich.FixRefusal) {
+	for _, r := range refused {
+		label := ""
+		if r.Rule != "" {
+			label = " (rule " + r.Rule + ")"
+		}
+		fmt.Fprintf(w, "REFUSED %s%s\n  %s\n", r.Path, label, r.Reason)
+	}
+}
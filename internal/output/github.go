@@ -0,0 +1,93 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// FormatGitHub writes the validation result as GitHub Actions workflow
+// commands, so that violations are shown as annotations on the pull request.
+//
+// Changed head lines are annotated where they are. Deleted base lines no
+// longer exist in the head, so they are annotated on the head line where the
+// deletion happened, and the message names the original base lines. If that
+// position is unknown the annotation is attached to the file instead.
+func FormatGitHub(w io.Writer, result *sandwich.Result) {
+	for _, f := range result.Files {
+		if f.Success || f.SkipReason != "" {
+			continue
+		}
+
+		title := "git-sandwich" + formatLabels(f)
+
+		if f.PolicyError != "" {
+			writeGitHubError(w, f.Path, nil, title, f.PolicyError)
+			continue
+		}
+		if len(f.BlockErrors) > 0 {
+			for _, e := range f.BlockErrors {
+				writeGitHubError(w, f.Path, blockErrorRange(f, e), title, e.Error())
+			}
+			continue
+		}
+
+		for _, r := range f.OutsideHead {
+			writeGitHubError(w, f.Path, &r, title,
+				fmt.Sprintf("Change outside %s (%s)", blockDescription(f, "head", r, "sandwich "), formatRanges([]diff.LineRange{r})))
+		}
+		for _, r := range f.OutsideBase {
+			writeGitHubError(w, f.Path, mapBaseRange(f, r), title,
+				fmt.Sprintf("Deletion outside %s (base %s)", blockDescription(f, "base", r, "sandwich "), formatRanges([]diff.LineRange{r})))
+		}
+		for _, r := range f.ProtectedHead {
+			writeGitHubError(w, f.Path, &r, title,
+				fmt.Sprintf("Change inside %s (%s)", blockDescription(f, "head", r, "protected "), formatRanges([]diff.LineRange{r})))
+		}
+		for _, r := range f.ProtectedBase {
+			writeGitHubError(w, f.Path, mapBaseRange(f, r), title,
+				fmt.Sprintf("Deletion inside %s (base %s)", blockDescription(f, "base", r, "protected "), formatRanges([]diff.LineRange{r})))
+		}
+
+		for _, c := range f.BlockChanges {
+			if !c.Denied {
+				continue
+			}
+			r := c.Head
+			if r == nil {
+				r = mapBaseRange(f, *c.Base)
+			}
+			writeGitHubError(w, f.Path, r, title, "Denied change: "+formatBlockChange(c))
+		}
+
+		if f.BoundaryChanged && (len(f.OutsideBase) > 0 || len(f.OutsideHead) > 0) {
+			writeGitHubError(w, f.Path, nil, title, "Block boundary changed together with changes outside blocks")
+		}
+	}
+}
+
+func writeGitHubError(w io.Writer, path string, r *diff.LineRange, title, msg string) {
+	props := "file=" + escapeGitHubProperty(path)
+	if r != nil {
+		props += fmt.Sprintf(",line=%d,endLine=%d", r.Start, r.End)
+	}
+	props += ",title=" + escapeGitHubProperty(title)
+	fmt.Fprintf(w, "::error %s::%s\n", props, escapeGitHubData(msg))
+}
+
+// escapeGitHubData escapes a workflow command message.
+func escapeGitHubData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+// escapeGitHubProperty escapes a workflow command property value.
+func escapeGitHubProperty(s string) string {
+	s = escapeGitHubData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
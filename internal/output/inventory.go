@@ -0,0 +1,44 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// FormatInventory writes the blocks as a table, followed by the files whose
+// blocks could not be parsed.
+func FormatInventory(w io.Writer, inv *sandwich.Inventory) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tRULE\tNAME\tSTART\tEND\tLINES")
+	for _, b := range inv.Blocks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\n",
+			b.Path, orDash(b.Rule), orDash(b.Name), b.StartLine, b.EndLine, b.Lines)
+	}
+	tw.Flush()
+
+	for _, e := range inv.Errors {
+		label := ""
+		if e.Rule != "" {
+			label = " (rule " + e.Rule + ")"
+		}
+		fmt.Fprintf(w, "error: %s%s: %s\n", e.Path, label, e.Error)
+	}
+}
+
+// FormatInventoryJSON writes the blocks in JSON format.
+func FormatInventoryJSON(w io.Writer, inv *sandwich.Inventory) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inv)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package output
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// FormatJUnit writes the validation result as a JUnit XML report. Each file
+// result becomes a test case named after the file, with its rule and commit
+// if any. Failed files carry a failure whose type is the SARIF rule ID of the
+// main violation and whose text lists every violation.
+func FormatJUnit(w io.Writer, result *sandwich.Result) error {
+	suite := junitTestSuite{Name: toolName}
+	for _, f := range result.Files {
+		tc := junitTestCase{Name: f.Path + formatLabels(f), ClassName: toolName}
+		switch {
+		case f.SkipReason != "":
+			tc.Skipped = &junitSkipped{Message: f.SkipReason}
+			suite.Skipped++
+		case !f.Success:
+			details := formatDetails(f)
+			tc.Failure = &junitFailure{
+				Message: strings.Join(details, "; "),
+				Type:    junitFailureType(f),
+				Text:    strings.Join(details, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+		suite.Tests++
+	}
+
+	suites := junitTestSuites{
+		Name:     toolName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitFailureType returns the rule ID of the first violation of a failed file.
+func junitFailureType(f sandwich.FileResult) string {
+	if ids := violationRuleIDs(f); len(ids) > 0 {
+		return ids[0]
+	}
+	return RuleOutsideChange
+}
@@ -0,0 +1,187 @@
+package output
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// DefaultMarkdownLimit keeps the report below the size limit of a GitHub
+// comment (65536 characters).
+const DefaultMarkdownLimit = 65000
+
+// MarkdownReporter writes the validation result as Markdown for a pull
+// request comment: a summary table, a collapsible section for every failed
+// file and a footer explaining how to fix each kind of violation found.
+type MarkdownReporter struct {
+	// MaxLength is the maximum length of the report in characters. File
+	// sections and the footer are shortened or left out to fit; only the
+	// summary table is always written. Zero means DefaultMarkdownLimit.
+	MaxLength int
+}
+
+// Report writes the Markdown report.
+func (r MarkdownReporter) Report(w io.Writer, result *sandwich.Result) error {
+	limit := r.MaxLength
+	if limit <= 0 {
+		limit = DefaultMarkdownLimit
+	}
+
+	var passed, failed, skipped int
+	var failures []sandwich.FileResult
+	seen := make(map[string]bool)
+	var ruleIDs []string
+	for _, f := range result.Files {
+		switch {
+		case f.SkipReason != "":
+			skipped++
+		case f.Success:
+			passed++
+		default:
+			failed++
+			failures = append(failures, f)
+			for _, id := range violationRuleIDs(f) {
+				if !seen[id] {
+					seen[id] = true
+					ruleIDs = append(ruleIDs, id)
+				}
+			}
+		}
+	}
+
+	var header strings.Builder
+	if result.Success {
+		header.WriteString("## :white_check_mark: git-sandwich passed\n\n")
+	} else {
+		header.WriteString("## :x: git-sandwich failed\n\n")
+	}
+	header.WriteString("| Checked | Passed | Failed | Skipped |\n")
+	header.WriteString("| ---: | ---: | ---: | ---: |\n")
+	fmt.Fprintf(&header, "| %d | %d | %d | %d |\n", len(result.Files), passed, failed, skipped)
+
+	// The header is always written. The footer is shortened, or left out,
+	// if it does not fit next to it and the note that no file could be
+	// shown. File sections fill the rest of the budget in order.
+	budget := limit - utf8.RuneCountInString(header.String())
+	reserved := 0
+	if len(failures) > 0 {
+		reserved = utf8.RuneCountInString(markdownOmitted(len(failures), false))
+	}
+	footer := markdownFooter(ruleIDs, true)
+	if utf8.RuneCountInString(footer)+reserved > budget {
+		footer = markdownFooter(ruleIDs, false)
+	}
+	if utf8.RuneCountInString(footer)+reserved > budget {
+		footer = ""
+	}
+	budget = max(budget-utf8.RuneCountInString(footer), 0)
+
+	var body strings.Builder
+	for i, f := range failures {
+		omitted := ""
+		if rest := len(failures) - i - 1; rest > 0 {
+			omitted = markdownOmitted(rest, true)
+		}
+		section := markdownSection(f, true)
+		if utf8.RuneCountInString(section)+utf8.RuneCountInString(omitted) > budget {
+			section = markdownSection(f, false)
+		}
+		if utf8.RuneCountInString(section)+utf8.RuneCountInString(omitted) > budget {
+			if note := markdownOmitted(len(failures)-i, i > 0); utf8.RuneCountInString(note) <= budget {
+				body.WriteString(note)
+			}
+			break
+		}
+		body.WriteString(section)
+		budget -= utf8.RuneCountInString(section)
+	}
+
+	_, err := io.WriteString(w, header.String()+body.String()+footer)
+	return err
+}
+
+// markdownSection returns the collapsible section of a failed file, with or
+// without its snippets.
+func markdownSection(f sandwich.FileResult, withSnippets bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n<details>\n<summary><code>%s</code>%s</summary>\n\n",
+		html.EscapeString(f.Path), html.EscapeString(formatLabels(f)))
+	for _, line := range formatDetails(f) {
+		fmt.Fprintf(&b, "- %s\n", markdownEscape(line))
+	}
+	if withSnippets {
+		for _, s := range f.Snippets {
+			b.WriteString("\n")
+			b.WriteString(markdownSnippet(s))
+		}
+	} else if len(f.Snippets) > 0 {
+		b.WriteString("\n_Snippets omitted to fit the comment size limit._\n")
+	}
+	b.WriteString("\n</details>\n")
+	return b.String()
+}
+
+// markdownSnippet returns a snippet as a diff code block. The fence is made
+// longer than any run of backticks in the snippet.
+func markdownSnippet(s sandwich.Snippet) string {
+	var lines []string
+	var prev *sandwich.SnippetLine
+	for i := range s.Lines {
+		l := &s.Lines[i]
+		if prev != nil && snippetGap(prev, l) {
+			lines = append(lines, "  ...")
+		}
+		prev = l
+		lines = append(lines, l.Kind+" "+l.Text)
+	}
+	content := strings.Join(lines, "\n")
+
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence + "diff\n" + content + "\n" + fence + "\n"
+}
+
+// markdownOmitted returns the note that n failed files were left out.
+func markdownOmitted(n int, more bool) string {
+	files := "failed files"
+	if n == 1 {
+		files = "failed file"
+	}
+	if more {
+		files = "more " + files
+	}
+	return fmt.Sprintf("\n_%d %s not shown to fit the comment size limit._\n", n, files)
+}
+
+// markdownFooter explains how to fix each kind of violation found, or with
+// withHelp false only names them.
+func markdownFooter(ruleIDs []string, withHelp bool) string {
+	if len(ruleIDs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n### How to fix\n\n")
+	for _, id := range ruleIDs {
+		rule := sarifRules[sarifRuleIndex(id)]
+		if withHelp {
+			fmt.Fprintf(&b, "- **%s**: %s\n", rule.ShortDescription.Text, rule.Help.Text)
+		} else {
+			fmt.Fprintf(&b, "- **%s**\n", rule.ShortDescription.Text)
+		}
+	}
+	return b.String()
+}
+
+// markdownEscape escapes the characters that would otherwise be read as
+// Markdown or HTML in a detail line.
+func markdownEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "<", "&lt;", ">", "&gt;",
+	).Replace(s)
+}
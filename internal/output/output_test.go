@@ -3,6 +3,10 @@ package output
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -59,9 +63,12 @@ func TestFormatText_BlockError(t *testing.T) {
 		Success: false,
 		Files: []sandwich.FileResult{
 			{
-				Path:       "broken.rb",
-				Success:    false,
-				BlockError: "BEGIN without matching END at line 5",
+				Path:    "broken.rb",
+				Success: false,
+				BlockErrors: []sandwich.BlockError{
+					{Kind: sandwich.ErrUnmatchedEnd, Line: 2, Message: "END without matching BEGIN at line 2"},
+					{Kind: sandwich.ErrUnclosedBegin, Line: 5, Message: "BEGIN without matching END at line 5"},
+				},
 			},
 		},
 	}
@@ -72,8 +79,168 @@ func TestFormatText_BlockError(t *testing.T) {
 	if !strings.Contains(output, "FAIL broken.rb") {
 		t.Errorf("expected FAIL line, got %q", output)
 	}
-	if !strings.Contains(output, "error: BEGIN without matching END") {
-		t.Errorf("expected error message, got %q", output)
+	if !strings.Contains(output, "error: END without matching BEGIN at line 2\n") ||
+		!strings.Contains(output, "error: BEGIN without matching END at line 5\n") {
+		t.Errorf("expected both error messages, got %q", output)
+	}
+}
+
+func TestFormatText_Labels(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:        "app.rb",
+				Rule:        "ruby",
+				Commit:      "0123456789abcdef0123456789abcdef01234567",
+				Success:     false,
+				OutsideHead: []diff.LineRange{{Start: 1, End: 1}},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	FormatText(&buf, result)
+	output := buf.String()
+
+	if !strings.Contains(output, "FAIL app.rb (rule ruby, commit 0123456789ab)") {
+		t.Errorf("expected FAIL line with rule and commit, got %q", output)
+	}
+}
+
+func TestFormatText_PolicyError(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:        ".git-sandwich.yml",
+				Success:     false,
+				PolicyError: "policy config changed",
+			},
+		},
+	}
+	var buf bytes.Buffer
+	FormatText(&buf, result)
+	output := buf.String()
+
+	if !strings.Contains(output, "FAIL .git-sandwich.yml") {
+		t.Errorf("expected FAIL line, got %q", output)
+	}
+	if !strings.Contains(output, "policy: policy config changed") {
+		t.Errorf("expected policy message, got %q", output)
+	}
+}
+
+func TestFormatText_Protected(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:          "LICENSE.rb",
+				Mode:          sandwich.ModeProtect,
+				Success:       false,
+				ProtectedBase: []diff.LineRange{{Start: 2, End: 3}},
+				ProtectedHead: []diff.LineRange{{Start: 2, End: 2}},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	FormatText(&buf, result)
+	output := buf.String()
+
+	if !strings.Contains(output, "protected(base): lines 2-3") {
+		t.Errorf("expected protected(base), got %q", output)
+	}
+	if !strings.Contains(output, "protected(head): lines 2") {
+		t.Errorf("expected protected(head), got %q", output)
+	}
+}
+
+func TestFormatText_DeniedBlockChanges(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:    "app.rb",
+				Success: false,
+				BlockChanges: []sandwich.BlockChange{
+					{Kind: sandwich.BlockDeleted, Name: "db_config", Base: &diff.LineRange{Start: 3, End: 5}, Denied: true},
+					{Kind: sandwich.BlockRenamed, Name: "cache", OldName: "store", Head: &diff.LineRange{Start: 7, End: 9}, Denied: true},
+					{Kind: sandwich.BlockResized, Head: &diff.LineRange{Start: 11, End: 20}},
+				},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	FormatText(&buf, result)
+	output := buf.String()
+
+	if !strings.Contains(output, `denied: block "db_config" deleted (base lines 3-5)`) {
+		t.Errorf("expected denied deletion, got %q", output)
+	}
+	if !strings.Contains(output, `denied: block "cache" renamed from "store" (head lines 7-9)`) {
+		t.Errorf("expected denied rename, got %q", output)
+	}
+	if strings.Contains(output, "resized") {
+		t.Errorf("expected allowed changes to be omitted, got %q", output)
+	}
+}
+
+func TestReporters_BlockNames(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{{
+			Path:        "config/application.rb",
+			Success:     false,
+			OutsideHead: []diff.LineRange{{Start: 25, End: 25}, {Start: 40, End: 41}},
+			RangeBlocks: []sandwich.RangeBlock{
+				{Side: "head", Lines: diff.LineRange{Start: 25, End: 25}, Name: "db_config"},
+			},
+		}},
+	}
+
+	var text, sarif, github, markdown bytes.Buffer
+	FormatText(&text, result)
+	if err := FormatSARIF(&sarif, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	FormatGitHub(&github, result)
+	if err := (MarkdownReporter{}).Report(&markdown, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		format, output, want string
+	}{
+		{"text", text.String(), "outside(head): lines 25 (outside block `db_config`), lines 40-41\n"},
+		{"sarif", sarif.String(), "Added or modified lines 25 outside block `db_config`"},
+		{"sarif", sarif.String(), "Added or modified lines 40-41 outside a block"},
+		{"github", github.String(), "::Change outside sandwich block `db_config` (lines 25)"},
+		{"github", github.String(), "::Change outside a sandwich block (lines 40-41)"},
+		{"markdown", markdown.String(), "- outside(head): lines 25 (outside block \\`db\\_config\\`), lines 40-41"},
+	} {
+		if !strings.Contains(tt.output, tt.want) {
+			t.Errorf("expected %q in %s output, got %q", tt.want, tt.format, tt.output)
+		}
+	}
+}
+
+func TestFormatSyncConflicts(t *testing.T) {
+	conflicts := []sandwich.SyncConflict{
+		{Name: "old", Lines: diff.LineRange{Start: 4, End: 6}},
+		{Lines: diff.LineRange{Start: 10, End: 12}},
+	}
+	var buf bytes.Buffer
+	FormatSyncConflicts(&buf, "app.rb", conflicts)
+	output := buf.String()
+
+	if !strings.Contains(output, "CONFLICT app.rb") {
+		t.Errorf("expected CONFLICT line, got %q", output)
+	}
+	if !strings.Contains(output, `block "old" (lines 4-6) no longer exists in the template`) {
+		t.Errorf("expected named conflict, got %q", output)
+	}
+	if !strings.Contains(output, "block (lines 10-12) no longer exists") {
+		t.Errorf("expected unnamed conflict, got %q", output)
 	}
 }
 
@@ -111,3 +278,477 @@ func TestFormatJSON(t *testing.T) {
 		t.Errorf("expected path config/application.rb, got %s", parsed.Files[0].Path)
 	}
 }
+
+func TestFormatSARIF(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:            "config/application.rb",
+				Success:         false,
+				OutsideBase:     []diff.LineRange{{Start: 10, End: 12}},
+				OutsideHead:     []diff.LineRange{{Start: 25, End: 25}},
+				BoundaryChanged: true,
+				Hunks:           []diff.Hunk{{OldStart: 10, OldLines: 3, NewStart: 9, NewLines: 0}},
+			},
+			{
+				Path:          "nohunks.rb",
+				Mode:          sandwich.ModeProtect,
+				Success:       false,
+				ProtectedBase: []diff.LineRange{{Start: 3, End: 3}},
+			},
+			{
+				Path:    "broken.rb",
+				Success: false,
+				BlockErrors: []sandwich.BlockError{
+					{Kind: sandwich.ErrUnclosedBegin, Side: "head", Line: 5, Message: "BEGIN without matching END at line 5"},
+				},
+			},
+			{Path: "ok.rb", Success: true},
+		},
+	}
+	var buf bytes.Buffer
+	if err := FormatSARIF(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var parsed sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("failed to parse SARIF: %v", err)
+	}
+	if parsed.Version != "2.1.0" {
+		t.Errorf("expected version 2.1.0, got %s", parsed.Version)
+	}
+	if len(parsed.Runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(parsed.Runs))
+	}
+	run := parsed.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(sarifRules) {
+		t.Errorf("expected %d rules, got %d", len(sarifRules), len(run.Tool.Driver.Rules))
+	}
+
+	var ruleIDs []string
+	for _, r := range run.Results {
+		ruleIDs = append(ruleIDs, r.RuleID)
+		if run.Tool.Driver.Rules[r.RuleIndex].ID != r.RuleID {
+			t.Errorf("ruleIndex %d does not point at %s", r.RuleIndex, r.RuleID)
+		}
+	}
+	expected := []string{RuleOutsideChange, RuleOutsideChange, RuleBoundaryWithOutside, RuleProtectedChange, RuleBlockStructure}
+	if strings.Join(ruleIDs, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected results %v, got %v", expected, ruleIDs)
+	}
+
+	// Base lines 10-12 were deleted after head line 9
+	base := run.Results[0]
+	if region := base.Locations[0].PhysicalLocation.Region; region == nil || region.StartLine != 9 || region.EndLine != 9 {
+		t.Errorf("expected base lines at head region 9-9, got %+v", region)
+	}
+	if !strings.Contains(base.Message.Text, "lines 10-12") {
+		t.Errorf("expected message to name base lines 10-12, got %q", base.Message.Text)
+	}
+	if base.Properties["side"] != "base" {
+		t.Errorf("expected side base, got %+v", base.Properties)
+	}
+	head := run.Results[1]
+	if region := head.Locations[0].PhysicalLocation.Region; region == nil || region.StartLine != 25 || region.EndLine != 25 {
+		t.Errorf("expected head region 25-25, got %+v", region)
+	}
+	if head.Properties["side"] != "head" {
+		t.Errorf("expected side head, got %+v", head.Properties)
+	}
+	unmapped := run.Results[3]
+	if region := unmapped.Locations[0].PhysicalLocation.Region; region != nil {
+		t.Errorf("expected no region without hunks, got %+v", region)
+	}
+	if unmapped.Properties["side"] != "base" {
+		t.Errorf("expected side base, got %+v", unmapped.Properties)
+	}
+	broken := run.Results[4]
+	if uri := broken.Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "broken.rb" {
+		t.Errorf("expected broken.rb, got %s", uri)
+	}
+	if region := broken.Locations[0].PhysicalLocation.Region; region == nil || region.StartLine != 5 {
+		t.Errorf("expected block error region at line 5, got %+v", region)
+	}
+	if broken.Properties["side"] != "head" {
+		t.Errorf("expected side head, got %+v", broken.Properties)
+	}
+}
+
+func TestFormatGitHub(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:        "config/application.rb",
+				Rule:        "ruby",
+				Success:     false,
+				OutsideBase: []diff.LineRange{{Start: 10, End: 12}},
+				OutsideHead: []diff.LineRange{{Start: 25, End: 26}},
+				Hunks: []diff.Hunk{
+					{OldStart: 10, OldLines: 3, NewStart: 9, NewLines: 0},
+					{OldStart: 27, OldLines: 0, NewStart: 25, NewLines: 2},
+				},
+			},
+			{
+				Path:    "broken.rb",
+				Success: false,
+				BlockErrors: []sandwich.BlockError{
+					{Kind: sandwich.ErrUnclosedBegin, Side: "head", Line: 5, Message: "BEGIN without matching END at line 5"},
+				},
+			},
+			{
+				Path:        "drift.rb",
+				Success:     false,
+				OutsideBase: []diff.LineRange{{Start: 3, End: 3}},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	FormatGitHub(&buf, result)
+	output := buf.String()
+
+	expected := []string{
+		"::error file=config/application.rb,line=25,endLine=26,title=git-sandwich (rule ruby)::Change outside a sandwich block (lines 25-26)\n",
+		"::error file=config/application.rb,line=9,endLine=9,title=git-sandwich (rule ruby)::Deletion outside a sandwich block (base lines 10-12)\n",
+		"::error file=broken.rb,line=5,endLine=5,title=git-sandwich::head: BEGIN without matching END at line 5\n",
+		"::error file=drift.rb,title=git-sandwich::Deletion outside a sandwich block (base lines 3)\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("expected %q, got %q", e, output)
+		}
+	}
+}
+
+func TestEscapeGitHubProperty(t *testing.T) {
+	if got := escapeGitHubProperty("a:b,c%d\ne"); got != "a%3Ab%2Cc%25d%0Ae" {
+		t.Errorf("unexpected escaping: %q", got)
+	}
+}
+
+func TestFormatJUnit(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:        "config/application.rb",
+				Rule:        "ruby",
+				Success:     false,
+				OutsideBase: []diff.LineRange{{Start: 10, End: 12}},
+				OutsideHead: []diff.LineRange{{Start: 25, End: 25}},
+			},
+			{
+				Path:    "broken.rb",
+				Success: false,
+				BlockErrors: []sandwich.BlockError{
+					{Kind: sandwich.ErrUnclosedBegin, Side: "head", Line: 5, Message: "BEGIN without matching END at line 5"},
+				},
+			},
+			{Path: "ok.rb", Success: true},
+			{Path: "new.rb", Success: true, SkipReason: "new file"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := FormatJUnit(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var parsed junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("failed to parse XML: %v", err)
+	}
+	if parsed.Tests != 4 || parsed.Failures != 2 || parsed.Skipped != 1 {
+		t.Errorf("expected 4 tests, 2 failures, 1 skipped, got %+v", parsed)
+	}
+	if len(parsed.Suites) != 1 || len(parsed.Suites[0].TestCases) != 4 {
+		t.Fatalf("expected 1 suite with 4 test cases, got %+v", parsed.Suites)
+	}
+	cases := parsed.Suites[0].TestCases
+
+	if cases[0].Name != "config/application.rb (rule ruby)" {
+		t.Errorf("expected name with rule label, got %q", cases[0].Name)
+	}
+	if f := cases[0].Failure; f == nil || f.Type != RuleOutsideChange ||
+		f.Text != "outside(base): lines 10-12\noutside(head): lines 25" {
+		t.Errorf("expected outside-change failure, got %+v", f)
+	}
+	if f := cases[1].Failure; f == nil || f.Type != RuleBlockStructure || !strings.Contains(f.Message, "BEGIN without matching END") {
+		t.Errorf("expected block-structure failure, got %+v", f)
+	}
+	if cases[2].Failure != nil || cases[2].Skipped != nil {
+		t.Errorf("expected passing test case, got %+v", cases[2])
+	}
+	if s := cases[3].Skipped; s == nil || s.Message != "new file" {
+		t.Errorf("expected skipped test case, got %+v", cases[3])
+	}
+}
+
+func TestNewReporter(t *testing.T) {
+	result := &sandwich.Result{Success: true}
+	for _, name := range []string{"text", "json", "sarif", "github", "junit"} {
+		reporter, err := NewReporter(name, Options{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := reporter.Report(&buf, result); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	if _, err := NewReporter("yaml", Options{}); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected unknown format error, got %v", err)
+	}
+	if _, err := NewReporter("template", Options{}); err == nil {
+		t.Error("expected error for template format without a template file")
+	}
+}
+
+func TestTemplateReporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.tmpl")
+	tmpl := `{{range failures .Files}}{{.Path}}{{labels .}}: {{join (details .) "; "}}
+{{end}}`
+	if err := os.WriteFile(path, []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reporter, err := NewReporter("template", Options{TemplateFile: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:        "app.rb",
+				Rule:        "ruby",
+				Success:     false,
+				OutsideHead: []diff.LineRange{{Start: 3, End: 4}},
+			},
+			{Path: "ok.rb", Success: true},
+		},
+	}
+	var buf bytes.Buffer
+	if err := reporter.Report(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := buf.String(); got != "app.rb (rule ruby): outside(head): lines 3-4\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestTemplateReporter_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.tmpl")
+	if err := os.WriteFile(path, []byte("{{range}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTemplateReporter(path); err == nil || !strings.Contains(err.Error(), "failed to parse template") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestTextReporter_Verbose(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:        "app.rb",
+				Success:     false,
+				OutsideHead: []diff.LineRange{{Start: 6, End: 6}},
+				Snippets: []sandwich.Snippet{{Lines: []sandwich.SnippetLine{
+					{Kind: " ", BaseLine: 4, HeadLine: 4, Text: "# END"},
+					{Kind: "+", HeadLine: 6, Text: "new"},
+				}}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := (TextReporter{Verbose: true}).Report(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "FAIL app.rb\n" +
+		"  outside(head): lines 6\n" +
+		"\n" +
+		"      4     4   # END\n" +
+		"    ...\n" +
+		"            6 + new\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	FormatText(&buf, result)
+	if strings.Contains(buf.String(), "new") {
+		t.Errorf("expected no snippets without verbose, got %q", buf.String())
+	}
+}
+
+func TestTextReporter_Color(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{Path: "app.rb", Success: false, OutsideHead: []diff.LineRange{{Start: 1, End: 1}}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := (TextReporter{Color: true}).Report(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), ansiRed+"FAIL"+ansiReset+" app.rb") {
+		t.Errorf("expected red FAIL, got %q", buf.String())
+	}
+}
+
+func TestMarkdownReporter(t *testing.T) {
+	result := &sandwich.Result{
+		Success: false,
+		Files: []sandwich.FileResult{
+			{
+				Path:            "config/application.rb",
+				Success:         false,
+				OutsideHead:     []diff.LineRange{{Start: 6, End: 6}},
+				BoundaryChanged: true,
+				Snippets: []sandwich.Snippet{{Lines: []sandwich.SnippetLine{
+					{Kind: " ", BaseLine: 4, HeadLine: 4, Text: "# END"},
+					{Kind: "+", HeadLine: 6, Text: "uses ``` fences"},
+				}}},
+			},
+			{Path: "ok.rb", Success: true},
+			{Path: "new.rb", Success: true, SkipReason: "new file"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := (MarkdownReporter{}).Report(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output := buf.String()
+
+	for _, e := range []string{
+		"## :x: git-sandwich failed",
+		"| 3 | 1 | 1 | 1 |",
+		"<summary><code>config/application.rb</code></summary>",
+		"- outside(head): lines 6",
+		"````diff\n  # END\n  ...\n+ uses ``` fences\n````",
+		"**Change outside a sandwich block**",
+		"**Block boundary changed together with outside changes**",
+	} {
+		if !strings.Contains(output, e) {
+			t.Errorf("expected %q in %q", e, output)
+		}
+	}
+	if strings.Contains(output, "ok.rb") {
+		t.Errorf("expected passing files to be left out, got %q", output)
+	}
+}
+
+func TestMarkdownReporter_MaxLength(t *testing.T) {
+	result := &sandwich.Result{Success: false}
+	for i := 0; i < 50; i++ {
+		result.Files = append(result.Files, sandwich.FileResult{
+			Path:        fmt.Sprintf("file%d.rb", i),
+			Success:     false,
+			OutsideHead: []diff.LineRange{{Start: 1, End: 1}},
+			Snippets: []sandwich.Snippet{{Lines: []sandwich.SnippetLine{
+				{Kind: "+", HeadLine: 1, Text: strings.Repeat("x", 100)},
+			}}},
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := (MarkdownReporter{MaxLength: 2000}).Report(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output := buf.String()
+
+	if len(output) > 2000 {
+		t.Errorf("expected at most 2000 characters, got %d", len(output))
+	}
+	if !strings.Contains(output, "<code>file0.rb</code>") {
+		t.Errorf("expected the first file to be shown, got %q", output)
+	}
+	if !strings.Contains(output, "more failed files not shown") {
+		t.Errorf("expected truncation note, got %q", output)
+	}
+	if !strings.Contains(output, "### How to fix") {
+		t.Errorf("expected footer to be kept, got %q", output)
+	}
+}
+
+func TestMarkdownReporter_SmallMaxLength(t *testing.T) {
+	result := &sandwich.Result{Success: false}
+	for i := 0; i < 3; i++ {
+		result.Files = append(result.Files, sandwich.FileResult{
+			Path:            fmt.Sprintf("file%d.rb", i),
+			Success:         false,
+			OutsideHead:     []diff.LineRange{{Start: 1, End: 1}},
+			BoundaryChanged: true,
+		})
+	}
+
+	// Below the length of the summary table, only the table is written.
+	tests := []struct {
+		maxLength int
+		fits      bool
+		want      []string
+		notWant   []string
+	}{
+		{400, true, []string{"3 failed files not shown", "- **Change outside a sandwich block**\n"}, []string{"Revert the change"}},
+		{200, true, []string{"3 failed files not shown"}, []string{"### How to fix"}},
+		{50, false, []string{"| 3 | 0 | 3 | 0 |"}, []string{"not shown", "### How to fix"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := (MarkdownReporter{MaxLength: tt.maxLength}).Report(&buf, result); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		output := buf.String()
+		if tt.fits && len(output) > tt.maxLength {
+			t.Errorf("MaxLength %d: expected at most %d characters, got %d", tt.maxLength, tt.maxLength, len(output))
+		}
+		for _, e := range tt.want {
+			if !strings.Contains(output, e) {
+				t.Errorf("MaxLength %d: expected %q in %q", tt.maxLength, e, output)
+			}
+		}
+		for _, e := range tt.notWant {
+			if strings.Contains(output, e) {
+				t.Errorf("MaxLength %d: expected no %q in %q", tt.maxLength, e, output)
+			}
+		}
+	}
+}
+
+func TestFormatFixRefusals(t *testing.T) {
+	refused := []sandwich.FixRefusal{
+		{Path: "app.rb", Rule: "ruby", Reason: "block boundary changed"},
+	}
+	var buf bytes.Buffer
+	FormatFixRefusals(&buf, refused)
+	if got := buf.String(); got != "REFUSED app.rb (rule ruby)\n  block boundary changed\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestFormatInventory(t *testing.T) {
+	inv := &sandwich.Inventory{
+		Blocks: []sandwich.BlockInfo{
+			{Path: "app.rb", Name: "db", StartLine: 3, EndLine: 7, Lines: 3},
+			{Path: "lib/x.rb", Rule: "ruby", StartLine: 10, EndLine: 11, Lines: 0},
+		},
+		Errors: []sandwich.InventoryError{
+			{Path: "broken.rb", Error: "BEGIN without matching END at line 5"},
+		},
+	}
+	var buf bytes.Buffer
+	FormatInventory(&buf, inv)
+	expected := "PATH      RULE  NAME  START  END  LINES\n" +
+		"app.rb    -     db    3      7    3\n" +
+		"lib/x.rb  ruby  -     10     11   0\n" +
+		"error: broken.rb: BEGIN without matching END at line 5\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
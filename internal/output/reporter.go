@@ -0,0 +1,94 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// Reporter writes a validation result in some output format.
+type Reporter interface {
+	Report(w io.Writer, result *sandwich.Result) error
+}
+
+// ReporterFunc adapts a function to the Reporter interface.
+type ReporterFunc func(w io.Writer, result *sandwich.Result) error
+
+// Report calls f(w, result).
+func (f ReporterFunc) Report(w io.Writer, result *sandwich.Result) error {
+	return f(w, result)
+}
+
+// Options holds the settings a reporter may need when it is created.
+type Options struct {
+	// TemplateFile is the path of the template used by the template format.
+	TemplateFile string
+	// Verbose prints source snippets in the text format.
+	Verbose bool
+	// Color enables ANSI colours in the text format.
+	Color bool
+	// MarkdownMaxLength is the character budget of the markdown format.
+	MarkdownMaxLength int
+}
+
+// Factory creates a reporter from the options.
+type Factory func(opts Options) (Reporter, error)
+
+var reporters = map[string]Factory{}
+
+// Register makes a reporter available under the given format name. It
+// panics if the name is already registered.
+func Register(name string, factory Factory) {
+	if _, ok := reporters[name]; ok {
+		panic(fmt.Sprintf("output: reporter %q registered twice", name))
+	}
+	reporters[name] = factory
+}
+
+// NewReporter creates the reporter registered under the given format name.
+func NewReporter(name string, opts Options) (Reporter, error) {
+	factory, ok := reporters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (want %s)", name, strings.Join(Formats(), ", "))
+	}
+	return factory(opts)
+}
+
+// Formats returns the registered format names in sorted order.
+func Formats() []string {
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// static returns a factory for a reporter that takes no options.
+func static(f ReporterFunc) Factory {
+	return func(Options) (Reporter, error) {
+		return f, nil
+	}
+}
+
+func init() {
+	Register("text", func(opts Options) (Reporter, error) {
+		return TextReporter{Verbose: opts.Verbose, Color: opts.Color}, nil
+	})
+	Register("json", static(FormatJSON))
+	Register("sarif", static(FormatSARIF))
+	Register("github", static(func(w io.Writer, result *sandwich.Result) error {
+		FormatGitHub(w, result)
+		return nil
+	}))
+	Register("junit", static(FormatJUnit))
+	Register("markdown", func(opts Options) (Reporter, error) {
+		return MarkdownReporter{MaxLength: opts.MarkdownMaxLength}, nil
+	})
+	Register("template", func(opts Options) (Reporter, error) {
+		return NewTemplateReporter(opts.TemplateFile)
+	})
+}
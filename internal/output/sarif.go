@@ -0,0 +1,256 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "git-sandwich"
+	toolURI      = "https://github.com/n0h0/git-sandwich"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	FullDescription      sarifMessage       `json:"fullDescription"`
+	Help                 sarifMessage       `json:"help"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	RuleIndex  int               `json:"ruleIndex"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// sarifRules describes every violation type. The order defines ruleIndex.
+var sarifRules = []sarifRule{
+	{
+		ID:                   RuleOutsideChange,
+		Name:                 "OutsideChange",
+		ShortDescription:     sarifMessage{"Change outside a sandwich block"},
+		FullDescription:      sarifMessage{"Lines outside any BEGIN/END block were added, modified or deleted. Only the contents of blocks may be edited."},
+		Help:                 sarifMessage{"Revert the change outside the block, or move it inside a block."},
+		DefaultConfiguration: sarifConfiguration{Level: "error"},
+	},
+	{
+		ID:                   RuleProtectedChange,
+		Name:                 "ProtectedChange",
+		ShortDescription:     sarifMessage{"Change inside a protected block"},
+		FullDescription:      sarifMessage{"Lines inside a block in protect mode, or its markers, were added, modified or deleted. Protected blocks must not be edited."},
+		Help:                 sarifMessage{"Revert the change to the protected block."},
+		DefaultConfiguration: sarifConfiguration{Level: "error"},
+	},
+	{
+		ID:                   RuleBoundaryWithOutside,
+		Name:                 "BoundaryWithOutside",
+		ShortDescription:     sarifMessage{"Block boundary changed together with outside changes"},
+		FullDescription:      sarifMessage{"A BEGIN/END marker was changed in the same diff as lines outside the blocks. This could disguise an outside edit as a boundary shift."},
+		Help:                 sarifMessage{"Move the boundary change into its own commit."},
+		DefaultConfiguration: sarifConfiguration{Level: "error"},
+	},
+	{
+		ID:                   RuleBlockStructure,
+		Name:                 "BlockStructure",
+		ShortDescription:     sarifMessage{"Invalid block structure"},
+		FullDescription:      sarifMessage{"The BEGIN/END markers are unmatched, improperly nested or have mismatching names."},
+		Help:                 sarifMessage{"Fix the markers so that every BEGIN has a matching END."},
+		DefaultConfiguration: sarifConfiguration{Level: "error"},
+	},
+	{
+		ID:                   RuleBlockChangeDenied,
+		Name:                 "BlockChangeDenied",
+		ShortDescription:     sarifMessage{"Denied block change"},
+		FullDescription:      sarifMessage{"A block was added, deleted, renamed, moved or resized, and the policy denies that kind of change."},
+		Help:                 sarifMessage{"Restore the block as it was in the base revision."},
+		DefaultConfiguration: sarifConfiguration{Level: "error"},
+	},
+	{
+		ID:                   RulePolicyConfigChanged,
+		Name:                 "PolicyConfigChanged",
+		ShortDescription:     sarifMessage{"Policy config changed"},
+		FullDescription:      sarifMessage{"The git-sandwich config file was changed by the diff it is validating."},
+		Help:                 sarifMessage{"Change the config in a separate, reviewed change."},
+		DefaultConfiguration: sarifConfiguration{Level: "error"},
+	},
+}
+
+// FormatSARIF writes the validation result as a SARIF 2.1.0 log.
+//
+// Each result is located by head line numbers. Deleted base lines no longer
+// exist in the head, so results for them are located at the head line where
+// the deletion happened, like GitHub annotations, and have the "side"
+// property set to "base"; the message names the original base lines. If
+// that position is unknown the result has no region.
+func FormatSARIF(w io.Writer, result *sandwich.Result) error {
+	results := []sarifResult{}
+	for _, f := range result.Files {
+		if f.Success || f.SkipReason != "" {
+			continue
+		}
+		results = append(results, sarifFileResults(f)...)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           toolName,
+				InformationURI: toolURI,
+				Rules:          sarifRules,
+			}},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func sarifFileResults(f sandwich.FileResult) []sarifResult {
+	var results []sarifResult
+
+	if f.PolicyError != "" {
+		results = append(results, newSarifResult(RulePolicyConfigChanged, f, f.PolicyError, nil, ""))
+	}
+	for _, e := range f.BlockErrors {
+		results = append(results, newSarifResult(RuleBlockStructure, f, e.Message, blockErrorRange(f, e), e.Side))
+	}
+
+	for _, r := range f.OutsideBase {
+		results = append(results, newSarifResult(RuleOutsideChange, f,
+			fmt.Sprintf("Deleted or modified %s outside %s (base)", formatRanges([]diff.LineRange{r}), blockDescription(f, "base", r, "")), mapBaseRange(f, r), "base"))
+	}
+	for _, r := range f.OutsideHead {
+		results = append(results, newSarifResult(RuleOutsideChange, f,
+			fmt.Sprintf("Added or modified %s outside %s", formatRanges([]diff.LineRange{r}), blockDescription(f, "head", r, "")), &r, "head"))
+	}
+	for _, r := range f.ProtectedBase {
+		results = append(results, newSarifResult(RuleProtectedChange, f,
+			fmt.Sprintf("Deleted or modified %s in %s (base)", formatRanges([]diff.LineRange{r}), blockDescription(f, "base", r, "protected ")), mapBaseRange(f, r), "base"))
+	}
+	for _, r := range f.ProtectedHead {
+		results = append(results, newSarifResult(RuleProtectedChange, f,
+			fmt.Sprintf("Added or modified %s in %s", formatRanges([]diff.LineRange{r}), blockDescription(f, "head", r, "protected ")), &r, "head"))
+	}
+
+	if f.BoundaryChanged && (len(f.OutsideBase) > 0 || len(f.OutsideHead) > 0) {
+		results = append(results, newSarifResult(RuleBoundaryWithOutside, f,
+			"Block boundary changed together with changes outside blocks", nil, ""))
+	}
+
+	for _, c := range f.BlockChanges {
+		if !c.Denied {
+			continue
+		}
+		msg := "Denied change: " + formatBlockChange(c)
+		if c.Head != nil {
+			results = append(results, newSarifResult(RuleBlockChangeDenied, f, msg, c.Head, "head"))
+		} else {
+			results = append(results, newSarifResult(RuleBlockChangeDenied, f, msg, mapBaseRange(f, *c.Base), "base"))
+		}
+	}
+
+	return results
+}
+
+func newSarifResult(ruleID string, f sandwich.FileResult, msg string, r *diff.LineRange, side string) sarifResult {
+	res := sarifResult{
+		RuleID:    ruleID,
+		RuleIndex: sarifRuleIndex(ruleID),
+		Level:     "error",
+		Message:   sarifMessage{Text: msg},
+		Locations: []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.Path},
+			},
+		}},
+	}
+	if r != nil {
+		res.Locations[0].PhysicalLocation.Region = &sarifRegion{StartLine: r.Start, EndLine: r.End}
+	}
+
+	props := make(map[string]string)
+	if side != "" {
+		props["side"] = side
+	}
+	if f.Rule != "" {
+		props["rule"] = f.Rule
+	}
+	if f.Commit != "" {
+		props["commit"] = f.Commit
+	}
+	if len(props) > 0 {
+		res.Properties = props
+	}
+	return res
+}
+
+func sarifRuleIndex(id string) int {
+	for i, r := range sarifRules {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
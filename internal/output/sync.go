@@ -0,0 +1,21 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// FormatSyncConflicts writes the blocks that could not be carried over by sync.
+func FormatSyncConflicts(w io.Writer, path string, conflicts []sandwich.SyncConflict) {
+	fmt.Fprintf(w, "CONFLICT %s\n", path)
+	for _, c := range conflicts {
+		name := "block"
+		if c.Name != "" {
+			name = fmt.Sprintf("block %q", c.Name)
+		}
+		fmt.Fprintf(w, "  %s (%s) no longer exists in the template\n", name, formatRanges([]diff.LineRange{c.Lines}))
+	}
+}
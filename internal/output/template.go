@@ -0,0 +1,66 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// templateFuncs are the functions available to templates in addition to the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	// ranges formats line ranges, e.g. "lines 3-5, lines 9"
+	"ranges": formatRanges,
+	// details returns the lines FormatText prints for a failed file
+	"details": formatDetails,
+	// labels returns the " (rule x, commit y)" suffix of a file
+	"labels": formatLabels,
+	// blockChange describes a block change
+	"blockChange": formatBlockChange,
+	// failures returns the files that failed validation
+	"failures": failedFiles,
+	"join":     strings.Join,
+}
+
+// TemplateReporter renders the result through a text/template. The template
+// is executed with the *sandwich.Result as its data.
+type TemplateReporter struct {
+	tmpl *template.Template
+}
+
+// NewTemplateReporter parses the template file at path.
+func NewTemplateReporter(path string) (*TemplateReporter, error) {
+	if path == "" {
+		return nil, errors.New("the template format requires --template-file")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return &TemplateReporter{tmpl: tmpl}, nil
+}
+
+// Report executes the template with result.
+func (r *TemplateReporter) Report(w io.Writer, result *sandwich.Result) error {
+	return r.tmpl.Execute(w, result)
+}
+
+func failedFiles(files []sandwich.FileResult) []sandwich.FileResult {
+	var failed []sandwich.FileResult
+	for _, f := range files {
+		if !f.Success && f.SkipReason == "" {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
@@ -9,10 +9,38 @@ import (
 	"github.com/n0h0/git-sandwich/internal/sandwich"
 )
 
+// ANSI escape sequences used by TextReporter when colour is enabled.
+const (
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+	ansiFaint = "\x1b[2m"
+)
+
+// TextReporter writes the validation result in human-readable text format.
+type TextReporter struct {
+	// Verbose prints the snippets of failed files below their details.
+	Verbose bool
+	// Color highlights the output with ANSI escape sequences.
+	Color bool
+}
+
 // FormatText writes the validation result in human-readable text format.
 func FormatText(w io.Writer, result *sandwich.Result) {
+	TextReporter{}.write(w, result)
+}
+
+// Report writes the validation result. It never fails.
+func (r TextReporter) Report(w io.Writer, result *sandwich.Result) error {
+	r.write(w, result)
+	return nil
+}
+
+func (r TextReporter) write(w io.Writer, result *sandwich.Result) {
+	ok := r.paint(ansiGreen, "OK")
 	if result.Success && len(result.Files) == 0 {
-		fmt.Fprintln(w, "OK")
+		fmt.Fprintln(w, ok)
 		return
 	}
 
@@ -24,7 +52,7 @@ func FormatText(w io.Writer, result *sandwich.Result) {
 		}
 	}
 	if allSkipped && result.Success {
-		fmt.Fprintln(w, "OK")
+		fmt.Fprintln(w, ok)
 		return
 	}
 
@@ -34,31 +62,112 @@ func FormatText(w io.Writer, result *sandwich.Result) {
 		}
 
 		if f.Success {
-			fmt.Fprintf(w, "OK %s\n", f.Path)
+			fmt.Fprintf(w, "%s %s%s\n", ok, f.Path, formatLabels(f))
 			continue
 		}
 
-		fmt.Fprintf(w, "FAIL %s\n", f.Path)
-
-		if f.BlockError != "" {
-			fmt.Fprintf(w, "  error: %s\n", f.BlockError)
-			continue
+		fmt.Fprintf(w, "%s %s%s\n", r.paint(ansiRed, "FAIL"), f.Path, formatLabels(f))
+		for _, line := range formatDetails(f) {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		if r.Verbose {
+			for _, s := range f.Snippets {
+				r.writeSnippet(w, s)
+			}
 		}
+	}
 
-		if len(f.OutsideBase) > 0 {
-			fmt.Fprintf(w, "  outside(base): %s\n", formatRanges(f.OutsideBase))
+	if result.Success {
+		fmt.Fprintln(w, ok)
+	}
+}
+
+// writeSnippet prints a snippet with base and head line numbers, marking
+// left-out lines with "...".
+func (r TextReporter) writeSnippet(w io.Writer, s sandwich.Snippet) {
+	fmt.Fprintln(w)
+	var prev *sandwich.SnippetLine
+	for i := range s.Lines {
+		l := &s.Lines[i]
+		if prev != nil && snippetGap(prev, l) {
+			fmt.Fprintf(w, "    %s\n", r.paint(ansiFaint, "..."))
 		}
-		if len(f.OutsideHead) > 0 {
-			fmt.Fprintf(w, "  outside(head): %s\n", formatRanges(f.OutsideHead))
+		prev = l
+
+		numbers := fmt.Sprintf("%5s %5s", lineNumber(l.BaseLine), lineNumber(l.HeadLine))
+		text := l.Kind + " " + l.Text
+		switch l.Kind {
+		case "-":
+			text = r.paint(ansiRed, text)
+		case "+":
+			text = r.paint(ansiGreen, text)
+		default:
+			text = r.paint(ansiCyan, text)
 		}
-		if f.BoundaryChanged {
-			fmt.Fprintln(w, "  note: boundary changed")
+		fmt.Fprintf(w, "  %s %s\n", r.paint(ansiFaint, numbers), text)
+	}
+}
+
+// snippetGap returns true if lines were left out between a and b on a side
+// both of them exist in.
+func snippetGap(a, b *sandwich.SnippetLine) bool {
+	if a.BaseLine > 0 && b.BaseLine > 0 && b.BaseLine > a.BaseLine+1 {
+		return true
+	}
+	return a.HeadLine > 0 && b.HeadLine > 0 && b.HeadLine > a.HeadLine+1
+}
+
+func lineNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprint(n)
+}
+
+func (r TextReporter) paint(color, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// formatDetails returns the lines describing why a file failed validation.
+// Policy and block structure errors are reported on their own, since the
+// other checks did not run.
+func formatDetails(f sandwich.FileResult) []string {
+	if f.PolicyError != "" {
+		return []string{"policy: " + f.PolicyError}
+	}
+	if len(f.BlockErrors) > 0 {
+		lines := make([]string, len(f.BlockErrors))
+		for i, e := range f.BlockErrors {
+			lines[i] = "error: " + e.Error()
 		}
+		return lines
 	}
 
-	if result.Success {
-		fmt.Fprintln(w, "OK")
+	var lines []string
+	if len(f.OutsideBase) > 0 {
+		lines = append(lines, "outside(base): "+formatNamedRanges(f, "base", f.OutsideBase, "outside"))
+	}
+	if len(f.OutsideHead) > 0 {
+		lines = append(lines, "outside(head): "+formatNamedRanges(f, "head", f.OutsideHead, "outside"))
+	}
+	if len(f.ProtectedBase) > 0 {
+		lines = append(lines, "protected(base): "+formatNamedRanges(f, "base", f.ProtectedBase, "in"))
+	}
+	if len(f.ProtectedHead) > 0 {
+		lines = append(lines, "protected(head): "+formatNamedRanges(f, "head", f.ProtectedHead, "in"))
 	}
+	for _, c := range f.BlockChanges {
+		if c.Denied {
+			lines = append(lines, "denied: "+formatBlockChange(c))
+		}
+	}
+	if f.BoundaryChanged {
+		lines = append(lines, "note: boundary changed")
+	}
+	return lines
 }
 
 func formatRanges(ranges []diff.LineRange) string {
@@ -72,3 +181,57 @@ func formatRanges(ranges []diff.LineRange) string {
 	}
 	return strings.Join(parts, ", ")
 }
+
+// formatNamedRanges formats violating ranges on side like formatRanges, and
+// names the block of each range where known, e.g.
+// "lines 3-4 (outside block `db`)".
+func formatNamedRanges(f sandwich.FileResult, side string, ranges []diff.LineRange, where string) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = formatRanges([]diff.LineRange{r})
+		if name := rangeBlockName(f, side, r); name != "" {
+			parts[i] += " (" + where + " block `" + name + "`)"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBlockChange describes a block change, e.g.
+// `block "db" renamed from "db_config" (head lines 3-7)`.
+func formatBlockChange(c sandwich.BlockChange) string {
+	var b strings.Builder
+	b.WriteString("block")
+	if c.Name != "" {
+		fmt.Fprintf(&b, " %q", c.Name)
+	}
+	fmt.Fprintf(&b, " %s", c.Kind)
+	if c.Kind == sandwich.BlockRenamed && c.OldName != "" {
+		fmt.Fprintf(&b, " from %q", c.OldName)
+	}
+	if c.Head != nil {
+		fmt.Fprintf(&b, " (head %s)", formatRanges([]diff.LineRange{*c.Head}))
+	} else if c.Base != nil {
+		fmt.Fprintf(&b, " (base %s)", formatRanges([]diff.LineRange{*c.Base}))
+	}
+	return b.String()
+}
+
+// formatLabels returns the rule and commit suffix for a file line, or an
+// empty string if the result has neither.
+func formatLabels(f sandwich.FileResult) string {
+	var labels []string
+	if f.Rule != "" {
+		labels = append(labels, "rule "+f.Rule)
+	}
+	if f.Commit != "" {
+		sha := f.Commit
+		if len(sha) > 12 {
+			sha = sha[:12]
+		}
+		labels = append(labels, "commit "+sha)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(labels, ", ") + ")"
+}
@@ -0,0 +1,89 @@
+package output
+
+import (
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// Rule IDs of the kinds of violations, shared by the SARIF, JUnit and
+// Markdown reports. These are stable and must not be renamed.
+const (
+	RuleOutsideChange       = "sandwich/outside-change"
+	RuleProtectedChange     = "sandwich/protected-change"
+	RuleBoundaryWithOutside = "sandwich/boundary-with-outside"
+	RuleBlockStructure      = "sandwich/block-structure"
+	RuleBlockChangeDenied   = "sandwich/block-change-denied"
+	RulePolicyConfigChanged = "sandwich/policy-config-changed"
+)
+
+// violationRuleIDs returns the rule IDs of the violations of a failed file,
+// most fundamental first.
+func violationRuleIDs(f sandwich.FileResult) []string {
+	if f.PolicyError != "" {
+		return []string{RulePolicyConfigChanged}
+	}
+	if len(f.BlockErrors) > 0 {
+		return []string{RuleBlockStructure}
+	}
+
+	var ids []string
+	hasOutside := len(f.OutsideBase) > 0 || len(f.OutsideHead) > 0
+	if hasOutside {
+		ids = append(ids, RuleOutsideChange)
+	}
+	if len(f.ProtectedBase) > 0 || len(f.ProtectedHead) > 0 {
+		ids = append(ids, RuleProtectedChange)
+	}
+	if f.BoundaryChanged && hasOutside {
+		ids = append(ids, RuleBoundaryWithOutside)
+	}
+	for _, c := range f.BlockChanges {
+		if c.Denied {
+			ids = append(ids, RuleBlockChangeDenied)
+			break
+		}
+	}
+	return ids
+}
+
+// mapBaseRange returns the single head line at which a range of base lines
+// was deleted, or nil if the result carries no hunks to map it with.
+func mapBaseRange(f sandwich.FileResult, r diff.LineRange) *diff.LineRange {
+	if f.Hunks == nil {
+		return nil
+	}
+	line := diff.MapOldLine(f.Hunks, r.Start)
+	return &diff.LineRange{Start: line, End: line}
+}
+
+// blockErrorRange returns the head line a block error refers to, or nil if it
+// has no line in the head file.
+func blockErrorRange(f sandwich.FileResult, e sandwich.BlockError) *diff.LineRange {
+	switch {
+	case e.Line == 0 || e.Side == "template":
+		return nil
+	case e.Side == "base":
+		return mapBaseRange(f, diff.LineRange{Start: e.Line, End: e.Line})
+	}
+	return &diff.LineRange{Start: e.Line, End: e.Line}
+}
+
+// rangeBlockName returns the name of the block a violating range on side is
+// in or nearest to, or an empty string if the block is unknown or unnamed.
+func rangeBlockName(f sandwich.FileResult, side string, r diff.LineRange) string {
+	for _, b := range f.RangeBlocks {
+		if b.Side == side && b.Lines == r {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// blockDescription refers to the block of a violating range, e.g.
+// "protected block `db`", or "a protected block" if it has no name.
+func blockDescription(f sandwich.FileResult, side string, r diff.LineRange, adjective string) string {
+	if name := rangeBlockName(f, side, r); name != "" {
+		return adjective + "block `" + name + "`"
+	}
+	return "a " + adjective + "block"
+}
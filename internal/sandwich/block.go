@@ -1,16 +1,103 @@
 package sandwich
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 )
 
+// BlockErrorKind identifies a kind of BlockError.
+type BlockErrorKind string
+
+const (
+	// ErrUnmatchedEnd is an END marker with no open block.
+	ErrUnmatchedEnd BlockErrorKind = "unmatched_end"
+	// ErrUnclosedBegin is a BEGIN marker that is never closed.
+	ErrUnclosedBegin BlockErrorKind = "unclosed_begin"
+	// ErrNestedBegin is a BEGIN marker inside a block when nesting is not allowed.
+	ErrNestedBegin BlockErrorKind = "nested_begin"
+	// ErrNameMismatch is an END marker whose name differs from the open block's.
+	ErrNameMismatch BlockErrorKind = "name_mismatch"
+	// ErrRead means the file could not be read, so its blocks are unknown.
+	ErrRead BlockErrorKind = "read"
+)
+
+// BlockError describes a problem with the block markers of a file. Line is
+// the marker line the error refers to. For name mismatches, Name is the END
+// marker's name and BeginName and BeginLine describe the open block.
+//
+// Side is set once the error is attached to a FileResult and tells which
+// version of the file it was found in: "base", "head" or "template".
+type BlockError struct {
+	Kind      BlockErrorKind `json:"kind"`
+	Side      string         `json:"side,omitempty"`
+	Line      int            `json:"line,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	BeginName string         `json:"begin_name,omitempty"`
+	BeginLine int            `json:"begin_line,omitempty"`
+	Message   string         `json:"message"`
+}
+
+func (e *BlockError) Error() string {
+	if e.Side != "" {
+		return e.Side + ": " + e.Message
+	}
+	return e.Message
+}
+
+// BlockErrors is the error returned by ParseBlocks. It holds every error
+// found, in the order of the lines they were detected at.
+type BlockErrors []*BlockError
+
+func (errs BlockErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual errors.
+func (errs BlockErrors) Unwrap() []error {
+	result := make([]error, len(errs))
+	for i, e := range errs {
+		result[i] = e
+	}
+	return result
+}
+
+// addBlockError marks the result as failed and records err, found in the
+// given side of the file. A BlockErrors is recorded error by error; any other
+// error is recorded as a single ErrRead error.
+func (fr *FileResult) addBlockError(side string, err error) {
+	fr.Success = false
+	var errs BlockErrors
+	if !errors.As(err, &errs) {
+		errs = BlockErrors{{Kind: ErrRead, Message: err.Error()}}
+	}
+	for _, e := range errs {
+		be := *e
+		be.Side = side
+		fr.BlockErrors = append(fr.BlockErrors, be)
+	}
+}
+
 // ParseBlocks scans the content line by line and returns matched BEGIN/END block pairs.
+//
+// If the marker regexes contain a capture group named "name", a BEGIN is only
+// closed by an END with the same name. Markers without a captured name pair
+// with any marker.
+//
+// The parser does not stop at the first error. A disallowed nested BEGIN
+// still opens a block and a mismatched END still closes the innermost one, so
+// that all errors are found in one pass. If there are any, the error is a
+// BlockErrors and no blocks are returned.
 func ParseBlocks(content string, startRe, endRe *regexp.Regexp, allowNesting bool) ([]Block, error) {
 	lines := strings.Split(content, "\n")
 	var blocks []Block
-	var stack []int // stack of BEGIN line numbers (1-indexed)
+	var errs BlockErrors
+	var stack []Block // open BEGIN markers; EndLine is not set yet
 
 	for i, line := range lines {
 		lineNum := i + 1
@@ -19,26 +106,69 @@ func ParseBlocks(content string, startRe, endRe *regexp.Regexp, allowNesting boo
 
 		if isStart {
 			if !allowNesting && len(stack) > 0 {
-				return nil, fmt.Errorf("nested BEGIN at line %d (nesting not allowed)", lineNum)
+				errs = append(errs, &BlockError{
+					Kind:    ErrNestedBegin,
+					Line:    lineNum,
+					Message: fmt.Sprintf("nested BEGIN at line %d (nesting not allowed)", lineNum),
+				})
 			}
-			stack = append(stack, lineNum)
+			stack = append(stack, Block{StartLine: lineNum, Name: markerName(startRe, line)})
 		} else if isEnd {
 			if len(stack) == 0 {
-				return nil, fmt.Errorf("END without matching BEGIN at line %d", lineNum)
+				errs = append(errs, &BlockError{
+					Kind:    ErrUnmatchedEnd,
+					Line:    lineNum,
+					Message: fmt.Sprintf("END without matching BEGIN at line %d", lineNum),
+				})
+				continue
+			}
+			open := stack[len(stack)-1]
+			if name := markerName(endRe, line); name != "" && open.Name != "" && name != open.Name {
+				errs = append(errs, &BlockError{
+					Kind:      ErrNameMismatch,
+					Line:      lineNum,
+					Name:      name,
+					BeginName: open.Name,
+					BeginLine: open.StartLine,
+					Message: fmt.Sprintf("block name mismatch: END %q at line %d does not match BEGIN %q at line %d",
+						name, lineNum, open.Name, open.StartLine),
+				})
 			}
-			startLine := stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			blocks = append(blocks, Block{StartLine: startLine, EndLine: lineNum})
+			open.EndLine = lineNum
+			blocks = append(blocks, open)
 		}
 	}
 
-	if len(stack) > 0 {
-		return nil, fmt.Errorf("BEGIN without matching END at line %d", stack[len(stack)-1])
+	for i := len(stack) - 1; i >= 0; i-- {
+		errs = append(errs, &BlockError{
+			Kind:    ErrUnclosedBegin,
+			Line:    stack[i].StartLine,
+			Name:    stack[i].Name,
+			Message: fmt.Sprintf("BEGIN without matching END at line %d", stack[i].StartLine),
+		})
 	}
 
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return blocks, nil
 }
 
+// markerName returns the "name" capture group of a marker line, or an empty
+// string if the regex has no such group or it did not match.
+func markerName(re *regexp.Regexp, line string) string {
+	idx := re.SubexpIndex("name")
+	if idx < 0 {
+		return ""
+	}
+	m := re.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[idx])
+}
+
 // HasBlocks returns true if the content contains any BEGIN or END markers.
 func HasBlocks(content string, startRe, endRe *regexp.Regexp) bool {
 	lines := strings.Split(content, "\n")
@@ -1,7 +1,9 @@
 package sandwich
 
 import (
+	"errors"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -109,6 +111,76 @@ func TestParseBlocks_UnmatchedEnd(t *testing.T) {
 	}
 }
 
+func TestParseBlocks_Named(t *testing.T) {
+	namedStart := regexp.MustCompile(`# START (?P<name>\w+)`)
+	namedEnd := regexp.MustCompile(`# END (?P<name>\w+)`)
+	content := `# START db_config
+content
+# END db_config
+# START cache
+content
+# END cache`
+
+	blocks, err := ParseBlocks(content, namedStart, namedEnd, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if blocks[0].Name != "db_config" || blocks[0].StartLine != 1 || blocks[0].EndLine != 3 {
+		t.Errorf("expected block db_config {1,3}, got %+v", blocks[0])
+	}
+	if blocks[1].Name != "cache" || blocks[1].StartLine != 4 || blocks[1].EndLine != 6 {
+		t.Errorf("expected block cache {4,6}, got %+v", blocks[1])
+	}
+}
+
+func TestParseBlocks_NameMismatch(t *testing.T) {
+	namedStart := regexp.MustCompile(`# START (?P<name>\w+)`)
+	namedEnd := regexp.MustCompile(`# END (?P<name>\w+)`)
+	content := `# START a
+content
+# END b`
+
+	_, err := ParseBlocks(content, namedStart, namedEnd, false)
+	if err == nil {
+		t.Fatal("expected error for name mismatch")
+	}
+	if !strings.Contains(err.Error(), "name mismatch") {
+		t.Errorf("expected name mismatch error, got %v", err)
+	}
+}
+
+func TestParseBlocks_NamedNested(t *testing.T) {
+	namedStart := regexp.MustCompile(`# START (?P<name>\w+)`)
+	namedEnd := regexp.MustCompile(`# END (?P<name>\w+)`)
+	content := `# START outer
+# START inner
+# END outer
+# END inner`
+
+	_, err := ParseBlocks(content, namedStart, namedEnd, true)
+	if err == nil {
+		t.Fatal("expected error for crossed named blocks")
+	}
+}
+
+func TestParseBlocks_UnnamedEndClosesNamedBegin(t *testing.T) {
+	namedStart := regexp.MustCompile(`# START (?P<name>\w+)`)
+	content := `# START a
+content
+# END`
+
+	blocks, err := ParseBlocks(content, namedStart, endRe, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(blocks) != 1 || blocks[0].Name != "a" {
+		t.Errorf("expected block a, got %+v", blocks)
+	}
+}
+
 func TestBlock_ContainsLine(t *testing.T) {
 	b := Block{StartLine: 5, EndLine: 10}
 
@@ -168,3 +240,57 @@ line 3`
 		t.Error("expected HasBlocks=false")
 	}
 }
+
+func TestParseBlocks_AllErrors(t *testing.T) {
+	content := `# START
+# START
+# END
+# END
+# END
+# START`
+
+	_, err := ParseBlocks(content, startRe, endRe, false)
+	var errs BlockErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected BlockErrors, got %v", err)
+	}
+	expected := []BlockError{
+		{Kind: ErrNestedBegin, Line: 2, Message: "nested BEGIN at line 2 (nesting not allowed)"},
+		{Kind: ErrUnmatchedEnd, Line: 5, Message: "END without matching BEGIN at line 5"},
+		{Kind: ErrUnclosedBegin, Line: 6, Message: "BEGIN without matching END at line 6"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i := range expected {
+		if *errs[i] != expected[i] {
+			t.Errorf("error %d: expected %+v, got %+v", i, expected[i], *errs[i])
+		}
+	}
+}
+
+func TestParseBlocks_NameMismatchRecovers(t *testing.T) {
+	content := `# START a
+x
+# END b
+# END`
+
+	namedStart := regexp.MustCompile(`# START (?P<name>\w+)`)
+	namedEnd := regexp.MustCompile(`# END ?(?P<name>\w*)`)
+	_, err := ParseBlocks(content, namedStart, namedEnd, false)
+	var errs BlockErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected BlockErrors, got %v", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	mismatch := errs[0]
+	if mismatch.Kind != ErrNameMismatch || mismatch.Line != 3 || mismatch.Name != "b" ||
+		mismatch.BeginName != "a" || mismatch.BeginLine != 1 {
+		t.Errorf("unexpected mismatch error: %+v", *mismatch)
+	}
+	if errs[1].Kind != ErrUnmatchedEnd || errs[1].Line != 4 {
+		t.Errorf("expected unmatched END at line 4, got %+v", *errs[1])
+	}
+}
@@ -0,0 +1,131 @@
+package sandwich
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+// Classes of a line relative to the blocks of a file.
+const (
+	lineInside   = "inside"
+	lineBoundary = "boundary"
+	lineOutside  = "outside"
+)
+
+// blockIndex classifies ranges of lines against a set of blocks without
+// looking at every line. It holds the inside and boundary lines as sorted,
+// non-overlapping segments; lines between segments are outside.
+//
+// A line is classified by the first block in the slice that contains it or
+// has a marker on it. For the blocks returned by
+// ParseBlocks, which are ordered by their END line, that is the innermost
+// block around the line.
+type blockIndex []lineSegment
+
+// lineSegment is a range of lines with the same class.
+type lineSegment struct {
+	diff.LineRange
+	class string
+}
+
+// newBlockIndex builds the index in O(n log n) for n blocks.
+func newBlockIndex(blocks []Block) blockIndex {
+	// Every line between two consecutive cut points is covered by the same
+	// blocks, and is either a marker line or not.
+	var cuts []int
+	for _, b := range blocks {
+		cuts = append(cuts, b.StartLine, b.StartLine+1, b.EndLine, b.EndLine+1)
+	}
+	sort.Ints(cuts)
+
+	byStart := make([]int, len(blocks))
+	for i := range byStart {
+		byStart[i] = i
+	}
+	sort.SliceStable(byStart, func(i, j int) bool {
+		return blocks[byStart[i]].StartLine < blocks[byStart[j]].StartLine
+	})
+
+	// Sweep over the pieces, keeping the blocks that have started in a heap
+	// ordered by their position in the slice. Blocks that have ended are
+	// dropped when they reach the top.
+	var idx blockIndex
+	var open blockHeap
+	next := 0
+	for i := 0; i+1 < len(cuts); i++ {
+		start, end := cuts[i], cuts[i+1]-1
+		if start > end {
+			continue
+		}
+		for next < len(byStart) && blocks[byStart[next]].StartLine <= start {
+			heap.Push(&open, byStart[next])
+			next++
+		}
+		for len(open) > 0 && blocks[open[0]].EndLine < start {
+			heap.Pop(&open)
+		}
+		if len(open) == 0 {
+			continue
+		}
+
+		b := blocks[open[0]]
+		class := lineInside
+		if b.IsBoundary(start) {
+			class = lineBoundary
+		}
+		if n := len(idx); n > 0 && idx[n-1].class == class && idx[n-1].End == start-1 {
+			idx[n-1].End = end
+			continue
+		}
+		idx = append(idx, lineSegment{LineRange: diff.LineRange{Start: start, End: end}, class: class})
+	}
+	return idx
+}
+
+// classify calls fn, in order, for every maximal part of r whose lines have
+// the same class.
+func (idx blockIndex) classify(r diff.LineRange, fn func(part diff.LineRange, class string)) {
+	if r.Start > r.End {
+		return
+	}
+	pos := r.Start
+	i := sort.Search(len(idx), func(i int) bool { return idx[i].End >= r.Start })
+	for ; i < len(idx) && idx[i].Start <= r.End; i++ {
+		seg := idx[i]
+		if seg.Start > pos {
+			fn(diff.LineRange{Start: pos, End: seg.Start - 1}, lineOutside)
+			pos = seg.Start
+		}
+		end := min(seg.End, r.End)
+		fn(diff.LineRange{Start: pos, End: end}, seg.class)
+		pos = end + 1
+	}
+	if pos <= r.End {
+		fn(diff.LineRange{Start: pos, End: r.End}, lineOutside)
+	}
+}
+
+// lineClass returns the class of a single line.
+func (idx blockIndex) lineClass(line int) string {
+	i := sort.Search(len(idx), func(i int) bool { return idx[i].End >= line })
+	if i < len(idx) && idx[i].Start <= line {
+		return idx[i].class
+	}
+	return lineOutside
+}
+
+// blockHeap is a min-heap of block positions.
+type blockHeap []int
+
+func (h blockHeap) Len() int           { return len(h) }
+func (h blockHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h blockHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *blockHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *blockHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,136 @@
+package sandwich
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+// CheckDrift compares each file against the file with the same relative path
+// in templateDir. The file content is read at cfg.HeadRef.
+//
+// Block contents are removed on both sides before comparing, so only the
+// regions outside blocks and the markers themselves have to match. For rules
+// in protect mode it is the other way around: only the blocks are compared.
+// Differences are reported with template lines on the base side and file
+// lines on the head side.
+func CheckDrift(ctx context.Context, cfg *Config, templateDir string) (*Result, error) {
+	var paths []string
+	err := filepath.WalkDir(templateDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(templateDir, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template dir: %w", err)
+	}
+
+	result := &Result{Success: true}
+	rules := cfg.rules()
+	for _, path := range paths {
+		if !shouldIncludeFile(path, cfg.IncludePatterns, cfg.ExcludePatterns) {
+			continue
+		}
+		matched := matchingRules(rules, path)
+		if len(matched) == 0 {
+			continue
+		}
+
+		template, err := os.ReadFile(filepath.Join(templateDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		for _, rule := range matched {
+			fr := driftFile(ctx, cfg, &rule, path, string(template))
+			result.Files = append(result.Files, fr)
+			if !fr.Success {
+				result.Success = false
+			}
+		}
+	}
+	return result, nil
+}
+
+func driftFile(ctx context.Context, cfg *Config, rule *Rule, path, template string) FileResult {
+	fr := FileResult{Path: path, Rule: rule.Name, Success: true}
+	if rule.Mode == ModeProtect {
+		fr.Mode = ModeProtect
+	}
+
+	content, exists, err := cfg.Repo().GetFileContent(ctx, cfg.HeadRef, path)
+	if err != nil {
+		fr.addBlockError("head", fmt.Errorf("failed to read file: %w", err))
+		return fr
+	}
+	if !exists {
+		fr.SkipReason = "not found"
+		return fr
+	}
+
+	templateBlocks, err := ParseBlocks(template, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
+	if err != nil {
+		fr.addBlockError("template", err)
+		return fr
+	}
+	blocks, err := ParseBlocks(content, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
+	if err != nil {
+		fr.addBlockError("head", err)
+		return fr
+	}
+
+	templateLines, templateNums := comparedLines(template, templateBlocks, rule.Mode)
+	lines, nums := comparedLines(content, blocks, rule.Mode)
+
+	var driftBase, driftHead []diff.LineRange
+	for _, h := range diff.Lines(templateLines, lines) {
+		for i := h.OldStart; i < h.OldStart+h.OldLines; i++ {
+			driftBase = appendOrExtend(driftBase, templateNums[i-1])
+		}
+		for i := h.NewStart; i < h.NewStart+h.NewLines; i++ {
+			driftHead = appendOrExtend(driftHead, nums[i-1])
+		}
+	}
+
+	if rule.Mode == ModeProtect {
+		fr.ProtectedBase, fr.ProtectedHead = driftBase, driftHead
+	} else {
+		fr.OutsideBase, fr.OutsideHead = driftBase, driftHead
+	}
+	if len(driftBase) > 0 || len(driftHead) > 0 {
+		fr.Success = false
+	}
+	fr.nameRanges(templateBlocks, blocks)
+	return fr
+}
+
+// comparedLines returns the lines of content that take part in a drift check
+// together with their original line numbers. Marker lines are always kept;
+// block contents are dropped in allow mode and kept in protect mode.
+func comparedLines(content string, blocks []Block, mode Mode) ([]string, []int) {
+	var lines []string
+	var nums []int
+	idx := newBlockIndex(blocks)
+	for i, line := range strings.Split(content, "\n") {
+		lineNum := i + 1
+		class := idx.lineClass(lineNum)
+		if class == lineBoundary || (class == lineInside) == (mode == ModeProtect) {
+			lines = append(lines, line)
+			nums = append(nums, lineNum)
+		}
+	}
+	return lines, nums
+}
@@ -0,0 +1,101 @@
+package sandwich
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+)
+
+func TestComparedLines(t *testing.T) {
+	content := "a\n# START\ninside\n# END\nb"
+	blocks := []Block{{StartLine: 2, EndLine: 4}}
+
+	lines, nums := comparedLines(content, blocks, ModeAllow)
+	wantNums := []int{1, 2, 4, 5}
+	if len(nums) != len(wantNums) {
+		t.Fatalf("allow: expected lines %v, got %v (%q)", wantNums, nums, lines)
+	}
+	for i := range nums {
+		if nums[i] != wantNums[i] {
+			t.Errorf("allow: expected lines %v, got %v", wantNums, nums)
+		}
+	}
+
+	lines, nums = comparedLines(content, blocks, ModeProtect)
+	wantNums = []int{2, 3, 4}
+	if len(nums) != len(wantNums) || lines[1] != "inside" {
+		t.Fatalf("protect: expected lines %v, got %v (%q)", wantNums, nums, lines)
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	templateDir := t.TempDir()
+	writeFile(t, templateDir, "config/app.rb", "header\n# START\ndefault\n# END\nfooter\n")
+	writeFile(t, templateDir, "config/db.rb", "header\n# START\ndefault\n# END\nfooter\n")
+	writeFile(t, templateDir, "config/missing.rb", "header\n")
+
+	// app.rb only customizes the block; db.rb also edits the footer
+	writeFile(t, dir, "config/app.rb", "header\n# START\ncustom\nmore custom\n# END\nfooter\n")
+	writeFile(t, dir, "config/db.rb", "header\n# START\ncustom\n# END\nCHANGED footer\n")
+	commit(t, dir, "base")
+
+	cfg := makeCfg()
+	cfg.HeadRef = git.WorktreeRef
+	result, err := CheckDrift(t.Context(), cfg, templateDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Error("expected drift in config/db.rb")
+	}
+	if len(result.Files) != 3 {
+		t.Fatalf("expected 3 files, got %+v", result.Files)
+	}
+
+	app, db, missing := result.Files[0], result.Files[1], result.Files[2]
+	if app.Path != "config/app.rb" || !app.Success {
+		t.Errorf("expected no drift in config/app.rb, got %+v", app)
+	}
+	if db.Path != "config/db.rb" || db.Success {
+		t.Errorf("expected drift in config/db.rb, got %+v", db)
+	}
+	if len(db.OutsideBase) != 1 || db.OutsideBase[0].Start != 5 {
+		t.Errorf("expected template line 5 to differ, got %+v", db.OutsideBase)
+	}
+	if len(db.OutsideHead) != 1 || db.OutsideHead[0].Start != 5 {
+		t.Errorf("expected file line 5 to differ, got %+v", db.OutsideHead)
+	}
+	if missing.SkipReason != "not found" {
+		t.Errorf("expected missing file to be skipped, got %+v", missing)
+	}
+
+	t.Run("protect mode compares blocks", func(t *testing.T) {
+		cfg := &Config{
+			HeadRef: git.WorktreeRef,
+			Rules: []Rule{{
+				Name:             "generated",
+				StartMarkerRegex: regexp.MustCompile(`# START`),
+				EndMarkerRegex:   regexp.MustCompile(`# END`),
+				Mode:             ModeProtect,
+				IncludePatterns:  []string{"config/app.rb"},
+			}},
+		}
+		result, err := CheckDrift(t.Context(), cfg, templateDir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Success || len(result.Files) != 1 {
+			t.Fatalf("expected drift inside the protected block, got %+v", result.Files)
+		}
+		if got := result.Files[0].ProtectedHead; len(got) != 1 || got[0].Start != 3 || got[0].End != 4 {
+			t.Errorf("expected protected(head) lines 3-4, got %+v", got)
+		}
+	})
+}
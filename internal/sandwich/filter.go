@@ -16,17 +16,33 @@ func filterFiles(fileDiffs []diff.FileDiff, includes, excludes []string) []diff.
 
 	var result []diff.FileDiff
 	for _, fd := range fileDiffs {
-		path := fd.NewPath
-		if fd.IsDeleted {
-			path = fd.OldPath
-		}
-		if shouldIncludeFile(path, includes, excludes) {
+		if shouldIncludeFile(diffPath(&fd), includes, excludes) {
 			result = append(result, fd)
 		}
 	}
 	return result
 }
 
+// matchingRules returns the rules whose include/exclude filters match the path.
+func matchingRules(rules []Rule, path string) []Rule {
+	var result []Rule
+	for _, r := range rules {
+		if shouldIncludeFile(path, r.IncludePatterns, r.ExcludePatterns) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// diffPath returns the path a file diff is reported under: the new path, or
+// the old path for deleted files.
+func diffPath(fd *diff.FileDiff) string {
+	if fd.IsDeleted {
+		return fd.OldPath
+	}
+	return fd.NewPath
+}
+
 // shouldIncludeFile checks whether a file path passes the include/exclude filters.
 // Logic: include first (if specified), then exclude.
 func shouldIncludeFile(path string, includes, excludes []string) bool {
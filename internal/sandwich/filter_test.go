@@ -165,3 +165,36 @@ func TestMatchesPattern(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchingRules(t *testing.T) {
+	rules := []Rule{
+		{Name: "ruby", IncludePatterns: []string{"**/*.rb"}},
+		{Name: "go", IncludePatterns: []string{"**/*.go"}, ExcludePatterns: []string{"vendor"}},
+		{Name: "all"},
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"app/models/user.rb", []string{"ruby", "all"}},
+		{"cmd/main.go", []string{"go", "all"}},
+		{"vendor/lib.go", []string{"all"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range matchingRules(rules, tt.path) {
+			got = append(got, r.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected rules %v, got %v", tt.path, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected rules %v, got %v", tt.path, tt.want, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package sandwich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/git"
+)
+
+// FixedFile is a working tree file with its violating changes reverted.
+type FixedFile struct {
+	Path     string
+	Original string
+	Content  string
+	// Deleted is true if the file was deleted from the working tree and is
+	// restored.
+	Deleted bool
+}
+
+// FixRefusal is a failed file that cannot be fixed automatically.
+type FixRefusal struct {
+	Path   string
+	Rule   string
+	Reason string
+}
+
+// FixResult represents the outcome of Fix.
+type FixResult struct {
+	Files   []FixedFile
+	Refused []FixRefusal
+}
+
+// Fix reverts the changes in the working tree that fail validation. Every
+// hunk with lines outside a block, or in protect mode inside a block or on
+// its markers, is restored to the base content; all other hunks are kept.
+// cfg.HeadRef must be git.WorktreeRef, and cfg.BaseRef should be the merge
+// base so that hunks and base content agree.
+//
+// A deleted file is a single hunk, so reverting it restores the whole base
+// file.
+//
+// A hunk never mixes lines inside and outside a block unless a marker is
+// part of it, so reverting whole hunks is exact. Files whose block
+// boundaries changed are refused instead, and so are files in protect mode
+// with a reverted hunk that also holds allowed lines outside blocks. Files
+// that fail for other reasons, such as invalid markers or denied block
+// changes, are refused too.
+func Fix(ctx context.Context, cfg *Config) (*FixResult, error) {
+	if cfg.HeadRef != git.WorktreeRef {
+		return nil, errors.New("fix only works on the working tree")
+	}
+	if cfg.PerCommit {
+		return nil, errors.New("fix cannot be used with --per-commit")
+	}
+
+	result, err := Validate(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// A file is checked once per matching rule; the hunks to revert are
+	// collected across all of them.
+	var paths []string
+	fixes := make(map[string]*fileFix)
+	for _, fr := range result.Files {
+		if fr.Success || fr.SkipReason != "" {
+			continue
+		}
+		fix, ok := fixes[fr.Path]
+		if !ok {
+			fix = &fileFix{oldPath: fr.Path, revert: make(map[int]bool)}
+			if fr.OldPath != "" {
+				fix.oldPath = fr.OldPath
+			}
+			fixes[fr.Path] = fix
+			paths = append(paths, fr.Path)
+		}
+
+		reason := fixRefusalReason(&fr)
+		if reason == "" {
+			fix.hunks = fr.Hunks
+			for i, h := range fr.Hunks {
+				if !isViolatingHunk(&fr, h) {
+					continue
+				}
+				fix.revert[i] = true
+				if fr.Mode == ModeProtect && !isProtectedHunk(&fr, h) && fix.mixed == nil {
+					fix.mixed = &FixRefusal{Path: fr.Path, Rule: fr.Rule, Reason: "protected and allowed changes share a hunk"}
+				}
+			}
+			if len(fix.revert) == 0 {
+				reason = "no changes to revert"
+			}
+		}
+		if reason != "" && fix.refusal == nil {
+			fix.refusal = &FixRefusal{Path: fr.Path, Rule: fr.Rule, Reason: reason}
+		}
+	}
+
+	fixResult := &FixResult{}
+	for _, path := range paths {
+		fix := fixes[path]
+		if fix.refusal != nil {
+			fixResult.Refused = append(fixResult.Refused, *fix.refusal)
+			continue
+		}
+
+		base, _, err := cfg.Repo().GetFileContent(ctx, cfg.BaseRef, fix.oldPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read base file %s: %w", fix.oldPath, err)
+		}
+		head, exists, err := cfg.Repo().GetFileContent(ctx, cfg.HeadRef, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !exists {
+			fixResult.Files = append(fixResult.Files, FixedFile{Path: path, Content: base, Deleted: true})
+			continue
+		}
+		if fix.mixed != nil {
+			fixResult.Refused = append(fixResult.Refused, *fix.mixed)
+			continue
+		}
+
+		var hunks []diff.Hunk
+		for i, h := range fix.hunks {
+			if fix.revert[i] {
+				hunks = append(hunks, h)
+			}
+		}
+		fixResult.Files = append(fixResult.Files, FixedFile{
+			Path:     path,
+			Original: head,
+			Content:  revertHunks(base, head, hunks),
+		})
+	}
+	return fixResult, nil
+}
+
+// fileFix collects what Fix will do with one file.
+type fileFix struct {
+	oldPath string
+	hunks   []diff.Hunk
+	revert  map[int]bool // indexes into hunks
+	refusal *FixRefusal
+	// mixed refuses the file unless it was deleted, which restores it
+	// as a whole anyway.
+	mixed *FixRefusal
+}
+
+// fixRefusalReason returns why a failed file cannot be fixed, or an empty
+// string if its violating hunks can be reverted.
+func fixRefusalReason(fr *FileResult) string {
+	switch {
+	case fr.PolicyError != "":
+		return fr.PolicyError
+	case len(fr.BlockErrors) > 0:
+		return fr.BlockErrors[0].Error()
+	case fr.BoundaryChanged:
+		return "block boundary changed"
+	case hasDeniedChange(fr.BlockChanges):
+		return "denied block change"
+	}
+	return ""
+}
+
+// isViolatingHunk returns true if the hunk contains an outside or protected line.
+func isViolatingHunk(fr *FileResult, h diff.Hunk) bool {
+	if r, ok := h.OldRange(); ok && (overlapsAny(r, fr.OutsideBase) || overlapsAny(r, fr.ProtectedBase)) {
+		return true
+	}
+	if r, ok := h.NewRange(); ok && (overlapsAny(r, fr.OutsideHead) || overlapsAny(r, fr.ProtectedHead)) {
+		return true
+	}
+	return false
+}
+
+// isProtectedHunk returns true if every line of the hunk, on both sides, is
+// inside a protected block or on one of its markers.
+func isProtectedHunk(fr *FileResult, h diff.Hunk) bool {
+	if r, ok := h.OldRange(); ok && !coveredBy(r, fr.ProtectedBase) {
+		return false
+	}
+	if r, ok := h.NewRange(); ok && !coveredBy(r, fr.ProtectedHead) {
+		return false
+	}
+	return true
+}
+
+// coveredBy returns true if every line of r is in one of the ranges, which
+// must not overlap each other.
+func coveredBy(r diff.LineRange, ranges []diff.LineRange) bool {
+	covered := 0
+	for _, o := range ranges {
+		if start, end := max(r.Start, o.Start), min(r.End, o.End); start <= end {
+			covered += end - start + 1
+		}
+	}
+	return covered == r.End-r.Start+1
+}
+
+// revertHunks returns head with the lines of each hunk replaced by the base
+// lines it changed. The hunks must be in file order.
+func revertHunks(base, head string, hunks []diff.Hunk) string {
+	baseLines := strings.Split(base, "\n")
+	headLines := strings.Split(head, "\n")
+
+	var out []string
+	next := 1 // next head line to copy
+	for _, h := range hunks {
+		// Last head line before the hunk
+		before := h.NewStart
+		if h.NewLines > 0 {
+			before = h.NewStart - 1
+		}
+		out = append(out, headLines[next-1:before]...)
+		if h.OldLines > 0 {
+			out = append(out, baseLines[h.OldStart-1:h.OldStart-1+h.OldLines]...)
+		}
+		next = before + h.NewLines + 1
+	}
+	out = append(out, headLines[next-1:]...)
+	return strings.Join(out, "\n")
+}
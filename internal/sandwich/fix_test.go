@@ -0,0 +1,133 @@
+package sandwich
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/git"
+)
+
+func TestRevertHunks(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	head := "A\nb\nc\nx\nd\n"
+	hunks := []diff.Hunk{
+		{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1}, // a -> A
+		{OldStart: 3, OldLines: 0, NewStart: 4, NewLines: 1}, // + x
+		{OldStart: 5, OldLines: 1, NewStart: 5, NewLines: 0}, // - e
+	}
+
+	if got := revertHunks(base, head, hunks); got != base {
+		t.Errorf("expected all hunks reverted to %q, got %q", base, got)
+	}
+	if got := revertHunks(base, head, hunks[1:2]); got != "A\nb\nc\nd\n" {
+		t.Errorf("expected only the insertion reverted, got %q", got)
+	}
+	if got := revertHunks(base, head, nil); got != head {
+		t.Errorf("expected head unchanged, got %q", got)
+	}
+}
+
+func TestFix(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	writeFile(t, dir, "moved.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	writeFile(t, dir, "app.rb", "CHANGED\n# START\nchanged inside\n# END\nline 5\nadded\n")
+	writeFile(t, dir, "moved.rb", "line 1\n# START v2\noriginal\n# END\nCHANGED\n")
+
+	cfg := makeCfg()
+	cfg.HeadRef = git.WorktreeRef
+	result, err := Fix(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Files) != 1 || result.Files[0].Path != "app.rb" {
+		t.Fatalf("expected app.rb to be fixed, got %+v", result.Files)
+	}
+	if got := result.Files[0].Content; got != "line 1\n# START\nchanged inside\n# END\nline 5\n" {
+		t.Errorf("expected outside changes reverted and inside change kept, got %q", got)
+	}
+
+	if len(result.Refused) != 1 || result.Refused[0].Path != "moved.rb" || result.Refused[0].Reason != "block boundary changed" {
+		t.Errorf("expected moved.rb to be refused, got %+v", result.Refused)
+	}
+}
+
+func TestFix_DeletedFile(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	base := "line 1\n# START\noriginal\n# END\nline 5\n"
+	writeFile(t, dir, "lib/app.rb", base)
+	commit(t, dir, "base")
+
+	os.RemoveAll(filepath.Join(dir, "lib"))
+
+	cfg := makeCfg()
+	cfg.HeadRef = git.WorktreeRef
+	result, err := Fix(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Refused) != 0 {
+		t.Errorf("expected no refusals, got %+v", result.Refused)
+	}
+	if len(result.Files) != 1 || result.Files[0].Path != "lib/app.rb" || result.Files[0].Content != base || !result.Files[0].Deleted {
+		t.Errorf("expected lib/app.rb to be restored from base, got %+v", result.Files)
+	}
+}
+
+func TestFix_ProtectMode(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	base := "# DO NOT EDIT BEGIN\nlicense\n# DO NOT EDIT END\nline 4\n"
+	writeFile(t, dir, "app.rb", base)
+	writeFile(t, dir, "lib.rb", base)
+	commit(t, dir, "base")
+
+	writeFile(t, dir, "app.rb", "# DO NOT EDIT BEGIN\nCHANGED\n# DO NOT EDIT END\nchanged 4\n")
+	writeFile(t, dir, "lib.rb", "# DO NOT EDIT BEGIN\nlicense\n# DO NOT EDIT END v2\nchanged 4\n")
+
+	cfg := makeCfg()
+	cfg.HeadRef = git.WorktreeRef
+	cfg.Rules = []Rule{{
+		Name:             "license",
+		StartMarkerRegex: regexp.MustCompile(`DO NOT EDIT BEGIN`),
+		EndMarkerRegex:   regexp.MustCompile(`DO NOT EDIT END`),
+		Mode:             ModeProtect,
+	}}
+	result, err := Fix(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Files) != 1 || result.Files[0].Path != "app.rb" {
+		t.Fatalf("expected app.rb to be fixed, got %+v", result.Files)
+	}
+	if got := result.Files[0].Content; got != "# DO NOT EDIT BEGIN\nlicense\n# DO NOT EDIT END\nchanged 4\n" {
+		t.Errorf("expected the protected change reverted and the outside change kept, got %q", got)
+	}
+	if len(result.Refused) != 1 || result.Refused[0].Path != "lib.rb" || result.Refused[0].Reason != "protected and allowed changes share a hunk" {
+		t.Errorf("expected lib.rb, whose marker and outside change share a hunk, to be refused, got %+v", result.Refused)
+	}
+}
+
+func TestFix_RequiresWorktree(t *testing.T) {
+	if _, err := Fix(t.Context(), makeCfg()); err == nil {
+		t.Error("expected error for a head other than the working tree")
+	}
+}
@@ -1,14 +1,21 @@
 package sandwich
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/git"
 )
 
-func setupTestRepo(t *testing.T) string {
+func setupTestRepo(t testing.TB) string {
 	t.Helper()
 	dir := t.TempDir()
 
@@ -34,7 +41,7 @@ func setupTestRepo(t *testing.T) string {
 	return dir
 }
 
-func writeFile(t *testing.T, dir, name, content string) {
+func writeFile(t testing.TB, dir, name, content string) {
 	t.Helper()
 	path := filepath.Join(dir, name)
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
@@ -45,7 +52,7 @@ func writeFile(t *testing.T, dir, name, content string) {
 	}
 }
 
-func commit(t *testing.T, dir, msg string) {
+func commit(t testing.TB, dir, msg string) {
 	t.Helper()
 	run := func(args ...string) {
 		t.Helper()
@@ -95,7 +102,7 @@ func TestIntegration_InsideChange_PASS(t *testing.T) {
 	commit(t, dir, "change inside")
 
 	cfg := makeCfg()
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -121,7 +128,7 @@ func TestIntegration_OutsideChange_FAIL(t *testing.T) {
 	commit(t, dir, "change outside")
 
 	cfg := makeCfg()
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -130,6 +137,39 @@ func TestIntegration_OutsideChange_FAIL(t *testing.T) {
 	}
 }
 
+func TestIntegration_OutsideChange_BlockName(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START db_config\noriginal\n# END db_config\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "app.rb", "line 1\n# START db_config\noriginal\n# END db_config\nCHANGED\n")
+	commit(t, dir, "change outside")
+
+	cfg := makeCfg()
+	cfg.StartMarkerRegex = regexp.MustCompile(`# START (?P<name>\w+)`)
+	cfg.EndMarkerRegex = regexp.MustCompile(`# END (?P<name>\w+)`)
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f := result.Files[0]
+	want := []RangeBlock{
+		{Side: "base", Lines: diff.LineRange{Start: 5, End: 5}, Name: "db_config"},
+		{Side: "head", Lines: diff.LineRange{Start: 5, End: 5}, Name: "db_config"},
+	}
+	if !reflect.DeepEqual(f.RangeBlocks, want) {
+		t.Errorf("expected %+v, got %+v", want, f.RangeBlocks)
+	}
+}
+
 func TestIntegration_BoundaryOnlyChange_PASS(t *testing.T) {
 	dir := setupTestRepo(t)
 	origDir, _ := os.Getwd()
@@ -152,7 +192,7 @@ func TestIntegration_BoundaryOnlyChange_PASS(t *testing.T) {
 	cfg.StartMarkerRegex = regexp.MustCompile(`# START`)
 	cfg.EndMarkerRegex = regexp.MustCompile(`# END`)
 
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -182,7 +222,7 @@ func TestIntegration_BoundaryPlusOutside_FAIL(t *testing.T) {
 	cfg.StartMarkerRegex = regexp.MustCompile(`# START`)
 	cfg.EndMarkerRegex = regexp.MustCompile(`# END`)
 
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -212,7 +252,7 @@ func TestIntegration_BoundaryPlusOutside_AllowFlag_PASS(t *testing.T) {
 	cfg.EndMarkerRegex = regexp.MustCompile(`# END`)
 	cfg.AllowBoundaryWithOutside = true
 
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -238,7 +278,7 @@ func TestIntegration_NewFile_PASS(t *testing.T) {
 	commit(t, dir, "add new file")
 
 	cfg := makeCfg()
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -265,15 +305,18 @@ func TestIntegration_BrokenBlocks_FAIL(t *testing.T) {
 	commit(t, dir, "break blocks")
 
 	cfg := makeCfg()
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if result.Success {
 		t.Error("expected failure for broken blocks")
 	}
-	if len(result.Files) > 0 && result.Files[0].BlockError == "" {
-		t.Error("expected block error")
+	if len(result.Files) == 0 || len(result.Files[0].BlockErrors) == 0 {
+		t.Fatal("expected block error")
+	}
+	if e := result.Files[0].BlockErrors[0]; e.Kind != ErrUnclosedBegin || e.Side != "head" || e.Line != 1 {
+		t.Errorf("expected unclosed BEGIN at head line 1, got %+v", e)
 	}
 }
 
@@ -294,7 +337,7 @@ func TestIntegration_NoBlocks_Skip(t *testing.T) {
 	commit(t, dir, "change file without blocks")
 
 	cfg := makeCfg()
-	result, err := Validate(cfg)
+	result, err := Validate(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -327,7 +370,7 @@ func TestIntegration_IncludeExclude(t *testing.T) {
 
 	t.Run("no filter fails", func(t *testing.T) {
 		cfg := makeCfg()
-		result, err := Validate(cfg)
+		result, err := Validate(t.Context(), cfg)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -339,7 +382,7 @@ func TestIntegration_IncludeExclude(t *testing.T) {
 	t.Run("include only src passes", func(t *testing.T) {
 		cfg := makeCfg()
 		cfg.IncludePatterns = []string{"src/**"}
-		result, err := Validate(cfg)
+		result, err := Validate(t.Context(), cfg)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -354,7 +397,7 @@ func TestIntegration_IncludeExclude(t *testing.T) {
 	t.Run("exclude vendor and docs passes", func(t *testing.T) {
 		cfg := makeCfg()
 		cfg.ExcludePatterns = []string{"vendor", "docs"}
-		result, err := Validate(cfg)
+		result, err := Validate(t.Context(), cfg)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -370,7 +413,7 @@ func TestIntegration_IncludeExclude(t *testing.T) {
 		cfg := makeCfg()
 		cfg.IncludePatterns = []string{"**/*.go"}
 		cfg.ExcludePatterns = []string{"vendor"}
-		result, err := Validate(cfg)
+		result, err := Validate(t.Context(), cfg)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -382,3 +425,729 @@ func TestIntegration_IncludeExclude(t *testing.T) {
 		}
 	})
 }
+
+func TestIntegration_Staged(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	// Stage an outside change, then revert it in the working tree only
+	writeFile(t, dir, "app.rb", "CHANGED\n# START\noriginal\n# END\nline 5\n")
+	if out, err := exec.Command("git", "add", "app.rb").CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v\n%s", err, out)
+	}
+	writeFile(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+
+	cfg := makeCfg()
+	cfg.HeadRef = git.StagedRef
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Errorf("expected failure for staged outside change, got success: %+v", result.Files)
+	}
+}
+
+func TestIntegration_Worktree(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	t.Run("inside change passes", func(t *testing.T) {
+		writeFile(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+		cfg := makeCfg()
+		cfg.HeadRef = git.WorktreeRef
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Success {
+			t.Errorf("expected success, got failure: %+v", result.Files)
+		}
+	})
+
+	t.Run("outside change fails", func(t *testing.T) {
+		writeFile(t, dir, "app.rb", "CHANGED\n# START\noriginal\n# END\nline 5\n")
+		cfg := makeCfg()
+		cfg.HeadRef = git.WorktreeRef
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Success {
+			t.Error("expected failure for outside change in working tree")
+		}
+		if len(result.Files) != 1 || len(result.Files[0].OutsideHead) != 1 || result.Files[0].OutsideHead[0].Start != 1 {
+			t.Errorf("expected outside(head) at line 1, got %+v", result.Files)
+		}
+	})
+}
+
+func TestIntegration_PerCommit(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	// Edit outside the block, then revert it in a later commit
+	writeFile(t, dir, "app.rb", "CHANGED\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "change outside")
+	out, _ := exec.Command("git", "rev-parse", "HEAD").Output()
+	badCommit := strings.TrimSpace(string(out))
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+	commit(t, dir, "revert outside, change inside")
+
+	t.Run("squashed diff passes", func(t *testing.T) {
+		cfg := makeCfg()
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Success {
+			t.Errorf("expected success for squashed diff, got failure: %+v", result.Files)
+		}
+	})
+
+	t.Run("per-commit fails on the offending commit", func(t *testing.T) {
+		cfg := makeCfg()
+		cfg.PerCommit = true
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Success {
+			t.Fatal("expected failure in per-commit mode")
+		}
+		if len(result.Commits) != 2 {
+			t.Errorf("expected 2 commits, got %d", len(result.Commits))
+		}
+		var failed []FileResult
+		for _, f := range result.Files {
+			if !f.Success {
+				failed = append(failed, f)
+			}
+		}
+		if len(failed) != 2 {
+			t.Fatalf("expected 2 failing file results (change and revert), got %+v", result.Files)
+		}
+		if failed[0].Commit != badCommit {
+			t.Errorf("expected first failure in commit %s, got %s", badCommit, failed[0].Commit)
+		}
+	})
+
+	t.Run("per-commit rejects pseudo-refs", func(t *testing.T) {
+		cfg := makeCfg()
+		cfg.PerCommit = true
+		cfg.HeadRef = git.WorktreeRef
+		if _, err := Validate(t.Context(), cfg); err == nil {
+			t.Error("expected error for per-commit with working tree")
+		}
+	})
+}
+
+func TestIntegration_PerCommit_Merges(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	gitRun := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test",
+			"GIT_AUTHOR_EMAIL=test@test.com",
+			"GIT_COMMITTER_NAME=test",
+			"GIT_COMMITTER_EMAIL=test@test.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+	gitRun("tag", "base")
+
+	// Upstream edits outside the block; the merge brings this change in
+	writeFile(t, dir, "app.rb", "UPSTREAM\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "upstream change")
+
+	gitRun("checkout", "-b", "feature", "base")
+	writeFile(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+	commit(t, dir, "change inside")
+	gitRun("merge", "--no-edit", "main")
+
+	tests := []struct {
+		policy  MergePolicy
+		success bool
+	}{
+		{MergeSkip, true},
+		{MergeFirstParent, false},
+		{MergeAllParents, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			cfg := makeCfg()
+			cfg.PerCommit = true
+			cfg.MergePolicy = tt.policy
+			result, err := Validate(t.Context(), cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Success != tt.success {
+				t.Errorf("expected success=%v, got %+v", tt.success, result.Files)
+			}
+		})
+	}
+}
+
+func TestIntegration_ProtectedPathChanged_FAIL(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, ".git-sandwich.yml", "start: \"# START\"\nend: \"# END\"\n")
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, ".git-sandwich.yml", "start: \"# START\"\nend: \"# END\"\nexclude: [\"**\"]\n")
+	writeFile(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+	commit(t, dir, "relax config")
+
+	cfg := makeCfg()
+	cfg.ProtectedPaths = []string{".git-sandwich.yml"}
+	cfg.ExcludePatterns = []string{"**"}
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Fatal("expected failure for changed config")
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("expected 1 file, got %+v", result.Files)
+	}
+	if result.Files[0].Path != ".git-sandwich.yml" || result.Files[0].PolicyError == "" {
+		t.Errorf("expected policy error for config file, got %+v", result.Files[0])
+	}
+}
+
+func TestIntegration_NamedRules(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# CUSTOM START\noriginal\n# CUSTOM END\nline 5\n")
+	writeFile(t, dir, "main.go", "line 1\n// CUSTOM START\noriginal\n// CUSTOM END\nline 5\n")
+	writeFile(t, dir, "schema.sql", "line 1\n-- CUSTOM START\noriginal\n-- CUSTOM END\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "app.rb", "line 1\n# CUSTOM START\nmodified\n# CUSTOM END\nline 5\n")
+	writeFile(t, dir, "main.go", "CHANGED\n// CUSTOM START\noriginal\n// CUSTOM END\nline 5\n")
+	writeFile(t, dir, "schema.sql", "CHANGED\n-- CUSTOM START\noriginal\n-- CUSTOM END\nline 5\n")
+	commit(t, dir, "changes")
+
+	cfg := &Config{
+		BaseRef: "main",
+		HeadRef: "HEAD",
+		Rules: []Rule{
+			{
+				Name:             "ruby",
+				StartMarkerRegex: regexp.MustCompile(`^# CUSTOM START`),
+				EndMarkerRegex:   regexp.MustCompile(`^# CUSTOM END`),
+				IncludePatterns:  []string{"**/*.rb"},
+			},
+			{
+				Name:             "go",
+				StartMarkerRegex: regexp.MustCompile(`^// CUSTOM START`),
+				EndMarkerRegex:   regexp.MustCompile(`^// CUSTOM END`),
+				IncludePatterns:  []string{"**/*.go"},
+			},
+		},
+	}
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Error("expected failure for outside change in main.go")
+	}
+
+	// schema.sql matches no rule and is reported as skipped
+	if len(result.Files) != 3 {
+		t.Fatalf("expected 3 file results, got %+v", result.Files)
+	}
+	byPath := make(map[string]FileResult)
+	for _, f := range result.Files {
+		byPath[f.Path] = f
+	}
+	if f := byPath["app.rb"]; !f.Success || f.Rule != "ruby" {
+		t.Errorf("expected app.rb to pass under rule ruby, got %+v", f)
+	}
+	if f := byPath["main.go"]; f.Success || f.Rule != "go" {
+		t.Errorf("expected main.go to fail under rule go, got %+v", f)
+	}
+	if f := byPath["schema.sql"]; !f.Success || f.SkipReason != "no matching rule" {
+		t.Errorf("expected schema.sql to be skipped, got %+v", f)
+	}
+}
+
+func TestIntegration_ProtectMode(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "# DO NOT EDIT BEGIN\nlicense\n# DO NOT EDIT END\nline 4\n")
+	writeFile(t, dir, "lib.rb", "# DO NOT EDIT BEGIN\nlicense\n# DO NOT EDIT END\nline 4\n")
+	writeFile(t, dir, "custom.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "app.rb", "# DO NOT EDIT BEGIN\nlicense\n# DO NOT EDIT END\nCHANGED\n")
+	writeFile(t, dir, "lib.rb", "# DO NOT EDIT BEGIN\nCHANGED\n# DO NOT EDIT END\nline 4\n")
+	writeFile(t, dir, "custom.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+	commit(t, dir, "changes")
+
+	cfg := makeCfg()
+	cfg.Rules = []Rule{{
+		Name:             "license",
+		StartMarkerRegex: regexp.MustCompile(`DO NOT EDIT BEGIN`),
+		EndMarkerRegex:   regexp.MustCompile(`DO NOT EDIT END`),
+		Mode:             ModeProtect,
+	}}
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Error("expected failure for change inside protected block")
+	}
+
+	byKey := make(map[string]FileResult)
+	for _, f := range result.Files {
+		if f.SkipReason == "" {
+			byKey[f.Path+"/"+f.Rule] = f
+		}
+	}
+	if f := byKey["app.rb/license"]; !f.Success || f.Mode != ModeProtect {
+		t.Errorf("expected outside change in app.rb to pass, got %+v", f)
+	}
+	f := byKey["lib.rb/license"]
+	if f.Success {
+		t.Errorf("expected inside change in lib.rb to fail, got %+v", f)
+	}
+	if len(f.ProtectedHead) != 1 || f.ProtectedHead[0].Start != 2 || f.ProtectedHead[0].End != 2 {
+		t.Errorf("expected protected(head) at line 2, got %+v", f.ProtectedHead)
+	}
+	if f := byKey["custom.rb/"]; !f.Success {
+		t.Errorf("expected inside change in custom.rb to pass under the default rule, got %+v", f)
+	}
+}
+
+func TestIntegration_DenyBlockDeletion(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n# START\nsecond\n# END\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	// Removing the second block only touches block lines, which is allowed by default
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "delete block")
+
+	t.Run("allowed by default", func(t *testing.T) {
+		cfg := makeCfg()
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Success {
+			t.Errorf("expected success, got failure: %+v", result.Files)
+		}
+		if len(result.Files) != 1 || len(result.Files[0].BlockChanges) != 1 {
+			t.Fatalf("expected 1 block change, got %+v", result.Files)
+		}
+		if c := result.Files[0].BlockChanges[0]; c.Kind != BlockDeleted || c.Denied {
+			t.Errorf("expected undenied deletion, got %+v", c)
+		}
+	})
+
+	t.Run("denied by policy", func(t *testing.T) {
+		cfg := makeCfg()
+		cfg.DenyBlockChanges = []BlockChangeKind{BlockDeleted}
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Success {
+			t.Error("expected failure for denied block deletion")
+		}
+		if len(result.Files) != 1 || !result.Files[0].BlockChanges[0].Denied {
+			t.Errorf("expected denied deletion, got %+v", result.Files)
+		}
+	})
+}
+
+func TestIntegration_DenyBlockAdded(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "plain.rb", "line 1\nline 2\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "new.rb", "line 1\n# START\nnew\n# END\n")
+	writeFile(t, dir, "plain.rb", "line 1\nline 2\n# START\nfirst\n# END\n")
+	writeFile(t, dir, "noblocks.rb", "no blocks\n")
+	commit(t, dir, "add blocks")
+
+	t.Run("allowed by default", func(t *testing.T) {
+		result, err := Validate(t.Context(), makeCfg())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Success {
+			t.Errorf("expected success, got failure: %+v", result.Files)
+		}
+		for _, f := range result.Files {
+			if f.Path == "noblocks.rb" {
+				if len(f.BlockChanges) != 0 || f.SkipReason != "new file" {
+					t.Errorf("expected noblocks.rb to be skipped without block changes, got %+v", f)
+				}
+				continue
+			}
+			if f.SkipReason == "" || len(f.BlockChanges) != 1 || f.BlockChanges[0].Kind != BlockAdded || f.BlockChanges[0].Denied {
+				t.Errorf("expected skipped %s with one undenied added block, got %+v", f.Path, f)
+			}
+		}
+	})
+
+	t.Run("denied by policy", func(t *testing.T) {
+		cfg := makeCfg()
+		cfg.DenyBlockChanges = []BlockChangeKind{BlockAdded}
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Success {
+			t.Error("expected failure for denied block additions")
+		}
+		byPath := make(map[string]FileResult)
+		for _, f := range result.Files {
+			byPath[f.Path] = f
+		}
+		for path, start := range map[string]int{"new.rb": 2, "plain.rb": 3} {
+			f := byPath[path]
+			if f.Success || f.SkipReason != "" || len(f.BlockChanges) != 1 {
+				t.Errorf("expected %s to fail with one added block, got %+v", path, f)
+				continue
+			}
+			if c := f.BlockChanges[0]; !c.Denied || c.Base != nil || c.Head == nil || *c.Head != (diff.LineRange{Start: start, End: start + 2}) {
+				t.Errorf("expected denied added block at %d in %s, got %+v", start, path, c)
+			}
+		}
+		if f := byPath["noblocks.rb"]; !f.Success {
+			t.Errorf("expected noblocks.rb to pass, got %+v", f)
+		}
+	})
+}
+
+func TestIntegration_Snippets(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\nchanged\n# END\nline 5 changed\n")
+	commit(t, dir, "change inside and outside")
+
+	cfg := makeCfg()
+	cfg.Snippets = true
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success || len(result.Files) != 1 {
+		t.Fatalf("expected 1 failing file, got %+v", result)
+	}
+
+	// Only the outside hunk is shown, after the nearest marker
+	snippets := result.Files[0].Snippets
+	if len(snippets) != 1 {
+		t.Fatalf("expected 1 snippet, got %+v", snippets)
+	}
+	lines := snippets[0].Lines
+	if len(lines) != 3 || lines[0].Text != "# END" || lines[1].Text != "line 5" || lines[2].Text != "line 5 changed" {
+		t.Errorf("expected marker, removed and added line, got %+v", lines)
+	}
+}
+
+func TestIntegration_Backends(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	writeFile(t, dir, "ok.rb", "# START\noriginal\n# END\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "app.rb", "line 1 changed\n# START\noriginal\n# END\nline 5\n")
+	writeFile(t, dir, "ok.rb", "# START\nmodified\n# END\n")
+	commit(t, dir, "change")
+
+	expected, err := Validate(t.Context(), makeCfg())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected.Success || len(expected.Files) != 2 {
+		t.Fatalf("expected failure with 2 files, got %+v", expected)
+	}
+
+	for _, backend := range []string{git.BackendBatch, git.BackendGoGit} {
+		repo, err := git.Open(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := makeCfg()
+		cfg.Repository = repo
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", backend, err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s: expected %+v, got %+v", backend, expected, result)
+		}
+		if c, ok := repo.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+func TestIntegration_ParallelOrder(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	for i := range 40 {
+		writeFile(t, dir, fmt.Sprintf("file%02d.rb", i), "line 1\n# START\noriginal\n# END\nline 5\n")
+	}
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	for i := range 40 {
+		content := "line 1\n# START\nmodified\n# END\nline 5\n"
+		if i%3 == 0 {
+			content = "line 1 changed\n# START\noriginal\n# END\nline 5\n"
+		}
+		writeFile(t, dir, fmt.Sprintf("file%02d.rb", i), content)
+	}
+	commit(t, dir, "change")
+
+	cfg := makeCfg()
+	cfg.Rules = []Rule{{
+		Name:             "protect",
+		StartMarkerRegex: regexp.MustCompile(`# START`),
+		EndMarkerRegex:   regexp.MustCompile(`# END`),
+		Mode:             ModeProtect,
+	}}
+	cfg.Jobs = 1
+	expected, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(expected.Files) != 80 {
+		t.Fatalf("expected 80 results, got %d", len(expected.Files))
+	}
+
+	for _, backend := range git.Backends() {
+		repo, err := git.Open(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Repository = repo
+		cfg.Jobs = 8
+		result, err := Validate(t.Context(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", backend, err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s: parallel result differs from sequential result", backend)
+		}
+		if c, ok := repo.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+func TestIntegration_GoGitWithoutGitBinary(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\noriginal\n# END\nline 5\n")
+	commit(t, dir, "base")
+
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\nmodified\n# END\nline 5\n")
+	commit(t, dir, "change inside")
+	writeFile(t, dir, "app.rb", "CHANGED\n# START\nmodified\n# END\nline 5\n")
+	commit(t, dir, "change outside")
+	writeFile(t, dir, "app.rb", "CHANGED\n# START\nmodified\n# END\nline 5 too\n")
+
+	repo, err := git.Open(git.BackendGoGit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", "")
+
+	cfg := makeCfg()
+	cfg.Repository = repo
+	result, err := Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Errorf("expected failure, got %+v", result)
+	}
+
+	cfg.PerCommit = true
+	result, err = Validate(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("per-commit: unexpected error: %v", err)
+	}
+	if result.Success || len(result.Files) != 2 || !result.Files[0].Success || result.Files[1].Success {
+		t.Errorf("per-commit: expected the second commit to fail, got %+v", result.Files)
+	}
+	cfg.PerCommit = false
+
+	inv, err := ListBlocks(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("list blocks: unexpected error: %v", err)
+	}
+	if len(inv.Blocks) != 1 || inv.Blocks[0].Path != "app.rb" {
+		t.Errorf("expected the block of app.rb, got %+v", inv)
+	}
+
+	cfg.BaseRef, err = repo.MergeBase(t.Context(), "main", "HEAD")
+	if err != nil {
+		t.Fatalf("merge base: unexpected error: %v", err)
+	}
+	cfg.HeadRef = git.WorktreeRef
+	fixed, err := Fix(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("fix: unexpected error: %v", err)
+	}
+	if len(fixed.Files) != 1 || fixed.Files[0].Content != "line 1\n# START\nmodified\n# END\nline 5\n" {
+		t.Errorf("expected app.rb to be fixed, got %+v", fixed)
+	}
+}
+
+// BenchmarkValidate_Backends validates a change to 2000 files with each
+// repository backend.
+func BenchmarkValidate_Backends(b *testing.B) {
+	dir := setupTestRepo(b)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	const files = 2000
+	for i := range files {
+		writeFile(b, dir, fmt.Sprintf("dir%02d/file%04d.rb", i%50, i), "line 1\n# START\noriginal\n# END\nline 5\n")
+	}
+	commit(b, dir, "base")
+	cmd := exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	cmd.Run()
+	for i := range files {
+		writeFile(b, dir, fmt.Sprintf("dir%02d/file%04d.rb", i%50, i), "line 1\n# START\nmodified\n# END\nline 5\n")
+	}
+	commit(b, dir, "change")
+
+	for _, backend := range git.Backends() {
+		b.Run(backend, func(b *testing.B) {
+			for range b.N {
+				repo, err := git.Open(backend)
+				if err != nil {
+					b.Fatal(err)
+				}
+				cfg := makeCfg()
+				cfg.Repository = repo
+				result, err := Validate(b.Context(), cfg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !result.Success || len(result.Files) != files {
+					b.Fatalf("expected %d passing files, got %+v", files, result)
+				}
+				if c, ok := repo.(io.Closer); ok {
+					c.Close()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package sandwich
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// BlockInfo describes a block found by ListBlocks. Lines is the number of
+// lines between the markers.
+type BlockInfo struct {
+	Path      string `json:"path"`
+	Rule      string `json:"rule,omitempty"`
+	Name      string `json:"name,omitempty"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Lines     int    `json:"lines"`
+}
+
+// InventoryError is a file whose blocks could not be parsed.
+type InventoryError struct {
+	Path  string `json:"path"`
+	Rule  string `json:"rule,omitempty"`
+	Error string `json:"error"`
+}
+
+// Inventory represents all blocks in the tree.
+type Inventory struct {
+	Blocks []BlockInfo      `json:"blocks"`
+	Errors []InventoryError `json:"errors,omitempty"`
+}
+
+// ListBlocks parses every tracked file at cfg.HeadRef that passes the file
+// filters and returns its blocks, ordered by path and position. Files are
+// parsed once for every rule that matches them.
+func ListBlocks(ctx context.Context, cfg *Config) (*Inventory, error) {
+	inv := &Inventory{Blocks: []BlockInfo{}}
+	err := scanTree(ctx, cfg, func(path, content string, rule *Rule) {
+		blocks, err := ParseBlocks(content, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
+		if err != nil {
+			inv.Errors = append(inv.Errors, InventoryError{Path: path, Rule: rule.Name, Error: err.Error()})
+			return
+		}
+		sort.Slice(blocks, func(i, j int) bool {
+			return blocks[i].StartLine < blocks[j].StartLine
+		})
+		for _, b := range blocks {
+			inv.Blocks = append(inv.Blocks, BlockInfo{
+				Path:      path,
+				Rule:      rule.Name,
+				Name:      b.Name,
+				StartLine: b.StartLine,
+				EndLine:   b.EndLine,
+				Lines:     b.EndLine - b.StartLine - 1,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// scanTree calls fn, in path order, for every tracked file at cfg.HeadRef
+// that passes the file filters, once for each matching rule whose markers
+// occur in the file.
+func scanTree(ctx context.Context, cfg *Config, fn func(path, content string, rule *Rule)) error {
+	paths, err := cfg.Repo().ListFiles(ctx, cfg.HeadRef)
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+	sort.Strings(paths)
+
+	rules := cfg.rules()
+	for _, path := range paths {
+		if !shouldIncludeFile(path, cfg.IncludePatterns, cfg.ExcludePatterns) {
+			continue
+		}
+		matched := matchingRules(rules, path)
+		if len(matched) == 0 {
+			continue
+		}
+
+		content, exists, err := cfg.Repo().GetFileContent(ctx, cfg.HeadRef, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !exists {
+			continue
+		}
+
+		for _, rule := range matched {
+			if HasBlocks(content, rule.StartMarkerRegex, rule.EndMarkerRegex) {
+				fn(path, content, &rule)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package sandwich
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+)
+
+func TestListBlocks(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "line 1\n# START\na\nb\n# END\n# START\n# END\n")
+	writeFile(t, dir, "plain.rb", "no blocks\n")
+	writeFile(t, dir, "vendor/lib.rb", "# START\nx\n# END\n")
+	commit(t, dir, "base")
+
+	// Untracked files are not listed, unparsable ones are reported
+	writeFile(t, dir, "untracked.rb", "# START\nx\n# END\n")
+	writeFile(t, dir, "plain.rb", "# START\n")
+
+	cfg := makeCfg()
+	cfg.HeadRef = git.WorktreeRef
+	cfg.ExcludePatterns = []string{"vendor/**"}
+	inv, err := ListBlocks(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []BlockInfo{
+		{Path: "app.rb", StartLine: 2, EndLine: 5, Lines: 2},
+		{Path: "app.rb", StartLine: 6, EndLine: 7, Lines: 0},
+	}
+	if len(inv.Blocks) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, inv.Blocks)
+	}
+	for i := range expected {
+		if inv.Blocks[i] != expected[i] {
+			t.Errorf("block %d: expected %+v, got %+v", i, expected[i], inv.Blocks[i])
+		}
+	}
+	if len(inv.Errors) != 1 || inv.Errors[0].Path != "plain.rb" {
+		t.Errorf("expected an error for plain.rb, got %+v", inv.Errors)
+	}
+
+	// At the committed ref, plain.rb has no blocks
+	cfg.HeadRef = "HEAD"
+	inv, err = ListBlocks(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inv.Blocks) != 2 || len(inv.Errors) != 0 {
+		t.Errorf("expected 2 blocks and no errors at HEAD, got %+v", inv)
+	}
+}
+
+func TestListBlocks_NamedRules(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "app.rb", "# START db\nx\n# END db\n")
+	writeFile(t, dir, "app.js", "// START\nx\n// END\n")
+	commit(t, dir, "base")
+
+	cfg := &Config{
+		HeadRef: "HEAD",
+		Rules: []Rule{{
+			Name:             "js",
+			StartMarkerRegex: regexp.MustCompile(`// START`),
+			EndMarkerRegex:   regexp.MustCompile(`// END`),
+			IncludePatterns:  []string{"*.js"},
+		}},
+	}
+	inv, err := ListBlocks(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inv.Blocks) != 1 || inv.Blocks[0].Path != "app.js" || inv.Blocks[0].Rule != "js" {
+		t.Errorf("expected only the js block, got %+v", inv.Blocks)
+	}
+}
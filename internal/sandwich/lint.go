@@ -0,0 +1,22 @@
+package sandwich
+
+import "context"
+
+// Lint checks the block structure of every tracked file at cfg.HeadRef that
+// passes the file filters, independent of any diff. Every file with markers
+// gets a result; for a broken file BlockErrors lists all of its errors.
+func Lint(ctx context.Context, cfg *Config) (*Result, error) {
+	result := &Result{Success: true}
+	err := scanTree(ctx, cfg, func(path, content string, rule *Rule) {
+		fr := FileResult{Path: path, Rule: rule.Name, Success: true}
+		if _, err := ParseBlocks(content, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting); err != nil {
+			fr.addBlockError("", err)
+			result.Success = false
+		}
+		result.Files = append(result.Files, fr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package sandwich
+
+import (
+	"os"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+)
+
+func TestLint(t *testing.T) {
+	dir := setupTestRepo(t)
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	writeFile(t, dir, "good.rb", "# START\nx\n# END\n")
+	writeFile(t, dir, "broken.rb", "# END\n# START\n")
+	writeFile(t, dir, "plain.rb", "no blocks\n")
+	commit(t, dir, "base")
+
+	cfg := makeCfg()
+	cfg.HeadRef = "HEAD"
+	result, err := Lint(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Error("expected failure for broken.rb")
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("expected results for the 2 files with markers, got %+v", result.Files)
+	}
+
+	broken := result.Files[0]
+	if broken.Path != "broken.rb" || broken.Success {
+		t.Fatalf("expected broken.rb to fail, got %+v", broken)
+	}
+	if len(broken.BlockErrors) != 2 ||
+		broken.BlockErrors[0].Kind != ErrUnmatchedEnd || broken.BlockErrors[0].Line != 1 ||
+		broken.BlockErrors[1].Kind != ErrUnclosedBegin || broken.BlockErrors[1].Line != 2 {
+		t.Errorf("expected both errors, got %+v", broken.BlockErrors)
+	}
+	if good := result.Files[1]; good.Path != "good.rb" || !good.Success {
+		t.Errorf("expected good.rb to pass, got %+v", good)
+	}
+
+	// Fixing the working tree is picked up without committing
+	writeFile(t, dir, "broken.rb", "# START\n# END\n")
+	cfg.HeadRef = git.WorktreeRef
+	result, err = Lint(t.Context(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("expected success for the working tree, got %+v", result.Files)
+	}
+}
@@ -0,0 +1,237 @@
+package sandwich
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+// minSimilarity is the minimum content similarity for two unnamed blocks to be
+// considered the same block.
+const minSimilarity = 0.5
+
+// blockPair is a base block matched with a head block, by index.
+type blockPair struct {
+	base int
+	head int
+}
+
+// MatchBlocks lines up base blocks with head blocks and returns how the blocks
+// changed between the two sides. Blocks are matched by name first, then by
+// content similarity, and finally by position among the unnamed blocks that
+// are left.
+func MatchBlocks(baseContent string, baseBlocks []Block, headContent string, headBlocks []Block) []BlockChange {
+	baseLines := strings.Split(baseContent, "\n")
+	headLines := strings.Split(headContent, "\n")
+
+	baseMatched := make([]bool, len(baseBlocks))
+	headMatched := make([]bool, len(headBlocks))
+	var pairs []blockPair
+
+	match := func(b, h int) {
+		baseMatched[b] = true
+		headMatched[h] = true
+		pairs = append(pairs, blockPair{base: b, head: h})
+	}
+
+	// 1. Same name
+	for b, bb := range baseBlocks {
+		if bb.Name == "" {
+			continue
+		}
+		for h, hb := range headBlocks {
+			if !headMatched[h] && hb.Name == bb.Name {
+				match(b, h)
+				break
+			}
+		}
+	}
+
+	// 2. Content similarity, best pairs first
+	type candidate struct {
+		blockPair
+		score float64
+	}
+	var candidates []candidate
+	for b, bb := range baseBlocks {
+		if baseMatched[b] {
+			continue
+		}
+		for h, hb := range headBlocks {
+			if headMatched[h] {
+				continue
+			}
+			score := similarity(blockBody(baseLines, bb), blockBody(headLines, hb))
+			if score >= minSimilarity {
+				candidates = append(candidates, candidate{blockPair{b, h}, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	for _, c := range candidates {
+		if !baseMatched[c.base] && !headMatched[c.head] {
+			match(c.base, c.head)
+		}
+	}
+
+	// 3. Position: only unnamed blocks, and only when they line up one to
+	// one. A named block that matched nothing was deleted or added.
+	var restBase, restHead []int
+	var unnamedBase, unnamedHead []int
+	for b, bb := range baseBlocks {
+		switch {
+		case baseMatched[b]:
+		case bb.Name == "":
+			unnamedBase = append(unnamedBase, b)
+		default:
+			restBase = append(restBase, b)
+		}
+	}
+	for h, hb := range headBlocks {
+		switch {
+		case headMatched[h]:
+		case hb.Name == "":
+			unnamedHead = append(unnamedHead, h)
+		default:
+			restHead = append(restHead, h)
+		}
+	}
+	if len(unnamedBase) == len(unnamedHead) {
+		for i := range unnamedBase {
+			match(unnamedBase[i], unnamedHead[i])
+		}
+	} else {
+		restBase = append(restBase, unnamedBase...)
+		restHead = append(restHead, unnamedHead...)
+		sort.Ints(restBase)
+		sort.Ints(restHead)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return baseBlocks[pairs[i].base].StartLine < baseBlocks[pairs[j].base].StartLine
+	})
+	moved := movedPairs(pairs, headBlocks)
+
+	var changes []BlockChange
+	for i, p := range pairs {
+		bb, hb := baseBlocks[p.base], headBlocks[p.head]
+		if bb.Name != hb.Name {
+			changes = append(changes, newBlockChange(BlockRenamed, &bb, &hb))
+		}
+		if moved[i] {
+			changes = append(changes, newBlockChange(BlockMoved, &bb, &hb))
+		}
+		if bb.EndLine-bb.StartLine != hb.EndLine-hb.StartLine {
+			changes = append(changes, newBlockChange(BlockResized, &bb, &hb))
+		}
+	}
+	for _, b := range restBase {
+		changes = append(changes, newBlockChange(BlockDeleted, &baseBlocks[b], nil))
+	}
+	for _, h := range restHead {
+		changes = append(changes, newBlockChange(BlockAdded, nil, &headBlocks[h]))
+	}
+	return changes
+}
+
+// addedBlocks reports every head block as added, for files without blocks in
+// base.
+func addedBlocks(headBlocks []Block) []BlockChange {
+	var changes []BlockChange
+	for i := range headBlocks {
+		changes = append(changes, newBlockChange(BlockAdded, nil, &headBlocks[i]))
+	}
+	return changes
+}
+
+// deletedBlocks reports every base block as deleted, for files removed in head.
+func deletedBlocks(baseBlocks []Block) []BlockChange {
+	var changes []BlockChange
+	for i := range baseBlocks {
+		changes = append(changes, newBlockChange(BlockDeleted, &baseBlocks[i], nil))
+	}
+	return changes
+}
+
+func newBlockChange(kind BlockChangeKind, base, head *Block) BlockChange {
+	c := BlockChange{Kind: kind}
+	if base != nil {
+		c.Name = base.Name
+		c.Base = &diff.LineRange{Start: base.StartLine, End: base.EndLine}
+	}
+	if head != nil {
+		if base != nil && base.Name != head.Name {
+			c.OldName = base.Name
+		}
+		c.Name = head.Name
+		c.Head = &diff.LineRange{Start: head.StartLine, End: head.EndLine}
+	}
+	return c
+}
+
+// movedPairs marks the pairs whose head order differs from their base order.
+// pairs must be sorted by base position; the pairs on the longest increasing
+// run of head positions stay in place and all others count as moved.
+func movedPairs(pairs []blockPair, headBlocks []Block) []bool {
+	n := len(pairs)
+	moved := make([]bool, n)
+	if n < 2 {
+		return moved
+	}
+
+	// O(n^2) longest increasing subsequence; files have few blocks
+	length := make([]int, n)
+	prev := make([]int, n)
+	best := 0
+	for i := range pairs {
+		length[i], prev[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if headBlocks[pairs[j].head].StartLine < headBlocks[pairs[i].head].StartLine && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if length[i] > length[best] {
+			best = i
+		}
+	}
+
+	for i := range moved {
+		moved[i] = true
+	}
+	for i := best; i >= 0; i = prev[i] {
+		moved[i] = false
+	}
+	return moved
+}
+
+// blockBody returns the lines between the markers of a block.
+func blockBody(lines []string, b Block) []string {
+	if b.EndLine-1 > len(lines) || b.StartLine >= b.EndLine-1 {
+		return nil
+	}
+	return lines[b.StartLine : b.EndLine-1]
+}
+
+// similarity returns the Dice coefficient of the two line multisets,
+// ignoring surrounding whitespace. Two empty bodies are not considered similar.
+func similarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	counts := make(map[string]int)
+	for _, l := range a {
+		counts[strings.TrimSpace(l)]++
+	}
+	common := 0
+	for _, l := range b {
+		key := strings.TrimSpace(l)
+		if counts[key] > 0 {
+			counts[key]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
@@ -0,0 +1,145 @@
+package sandwich
+
+import (
+	"regexp"
+	"testing"
+)
+
+var (
+	namedStartRe = regexp.MustCompile(`# START ?(?P<name>\w*)`)
+	namedEndRe   = regexp.MustCompile(`# END ?(?P<name>\w*)`)
+)
+
+func matchContents(t *testing.T, base, head string) []BlockChange {
+	t.Helper()
+	baseBlocks, err := ParseBlocks(base, namedStartRe, namedEndRe, false)
+	if err != nil {
+		t.Fatalf("base: unexpected error: %v", err)
+	}
+	headBlocks, err := ParseBlocks(head, namedStartRe, namedEndRe, false)
+	if err != nil {
+		t.Fatalf("head: unexpected error: %v", err)
+	}
+	return MatchBlocks(base, baseBlocks, head, headBlocks)
+}
+
+func changeKinds(changes []BlockChange) []BlockChangeKind {
+	var kinds []BlockChangeKind
+	for _, c := range changes {
+		kinds = append(kinds, c.Kind)
+	}
+	return kinds
+}
+
+func TestMatchBlocks_Unchanged(t *testing.T) {
+	content := "# START a\nx\n# END a\n# START b\ny\n# END b\n"
+	if changes := matchContents(t, content, content); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestMatchBlocks_ShiftedIsNotMoved(t *testing.T) {
+	base := "# START a\nx\n# END a\n"
+	head := "new line\nnew line\n# START a\nx\n# END a\n"
+	if changes := matchContents(t, base, head); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestMatchBlocks_AddedAndDeleted(t *testing.T) {
+	base := "# START a\nx\n# END a\n# START b\ny\n# END b\n"
+	head := "# START a\nx\n# END a\n# START c\nz\n# END c\n# START d\nw\n# END d\n"
+	changes := matchContents(t, base, head)
+
+	var added, deleted []string
+	for _, c := range changes {
+		switch c.Kind {
+		case BlockAdded:
+			added = append(added, c.Name)
+			if c.Head == nil || c.Base != nil {
+				t.Errorf("expected only head range for added block, got %+v", c)
+			}
+		case BlockDeleted:
+			deleted = append(deleted, c.Name)
+			if c.Base == nil || c.Head != nil {
+				t.Errorf("expected only base range for deleted block, got %+v", c)
+			}
+		default:
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+	if len(deleted) != 1 || deleted[0] != "b" {
+		t.Errorf("expected b deleted, got %v", deleted)
+	}
+	if len(added) != 2 || added[0] != "c" || added[1] != "d" {
+		t.Errorf("expected c and d added, got %v", added)
+	}
+}
+
+func TestMatchBlocks_RenamedByContent(t *testing.T) {
+	base := "# START db_config\nhost = db\nport = 5432\n# END db_config\n# START other\nunrelated\n# END other\n"
+	head := "# START database\nhost = db\nport = 5432\n# END database\n# START other\nunrelated\n# END other\n"
+	changes := matchContents(t, base, head)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", changes)
+	}
+	c := changes[0]
+	if c.Kind != BlockRenamed || c.Name != "database" || c.OldName != "db_config" {
+		t.Errorf("expected db_config renamed to database, got %+v", c)
+	}
+}
+
+func TestMatchBlocks_NamedNotPairedByPosition(t *testing.T) {
+	base := "# START a\nx\n# END a\n"
+	head := "# START b\ncompletely different\n# END b\n"
+	changes := matchContents(t, base, head)
+	kinds := changeKinds(changes)
+	if len(kinds) != 2 || kinds[0] != BlockDeleted || kinds[1] != BlockAdded {
+		t.Errorf("expected a deleted and b added, got %+v", changes)
+	}
+}
+
+func TestMatchBlocks_UnnamedPairedByPosition(t *testing.T) {
+	base := "# START\nx\n# END\n# START\ny\n# END\n"
+	head := "# START\ncompletely different\n# END\n# START\nalso different\n# END\n"
+	if changes := matchContents(t, base, head); len(changes) != 0 {
+		t.Errorf("expected the blocks to be paired by position, got %+v", changes)
+	}
+}
+
+func TestMatchBlocks_Moved(t *testing.T) {
+	base := "# START a\nx\n# END a\n# START b\ny\n# END b\n# START c\nz\n# END c\n"
+	head := "# START c\nz\n# END c\n# START a\nx\n# END a\n# START b\ny\n# END b\n"
+	changes := matchContents(t, base, head)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", changes)
+	}
+	if changes[0].Kind != BlockMoved || changes[0].Name != "c" {
+		t.Errorf("expected c moved, got %+v", changes[0])
+	}
+}
+
+func TestMatchBlocks_Resized(t *testing.T) {
+	base := "# START a\nx\n# END a\n"
+	head := "# START a\nx\ny\nz\n# END a\n"
+	changes := matchContents(t, base, head)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", changes)
+	}
+	c := changes[0]
+	if c.Kind != BlockResized || c.Base.End != 3 || c.Head.End != 5 {
+		t.Errorf("expected a resized from {1,3} to {1,5}, got %+v", c)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if got := similarity([]string{"a", "b"}, []string{"a", "b"}); got != 1 {
+		t.Errorf("expected 1 for identical bodies, got %v", got)
+	}
+	if got := similarity([]string{"a", "b"}, []string{"c", "d"}); got != 0 {
+		t.Errorf("expected 0 for disjoint bodies, got %v", got)
+	}
+	if got := similarity(nil, nil); got != 0 {
+		t.Errorf("expected 0 for empty bodies, got %v", got)
+	}
+}
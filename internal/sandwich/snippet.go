@@ -0,0 +1,105 @@
+package sandwich
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+// maxSnippetSide is the number of lines shown from each side of a hunk.
+// Longer sides are shortened to their first and last lines.
+const maxSnippetSide = 10
+
+// attachSnippets sets fr.Snippets if snippets are enabled and the file failed.
+// headBlocks are used for context and may be nil, e.g. for a deleted file.
+func attachSnippets(cfg *Config, fr *FileResult, baseContent, headContent string, headBlocks []Block) {
+	if cfg.Snippets && !fr.Success {
+		fr.Snippets = buildSnippets(fr, baseContent, headContent, headBlocks)
+	}
+}
+
+// buildSnippets returns a snippet for every hunk of fr that contains an
+// outside or protected line. Each snippet holds the removed and added lines
+// of the hunk, preceded and followed by the nearest marker line in the head.
+func buildSnippets(fr *FileResult, baseContent, headContent string, headBlocks []Block) []Snippet {
+	baseLines := strings.Split(baseContent, "\n")
+	headLines := strings.Split(headContent, "\n")
+	baseViolations := append(append([]diff.LineRange{}, fr.OutsideBase...), fr.ProtectedBase...)
+	headViolations := append(append([]diff.LineRange{}, fr.OutsideHead...), fr.ProtectedHead...)
+
+	var markers []int
+	for _, b := range headBlocks {
+		markers = append(markers, b.StartLine, b.EndLine)
+	}
+	sort.Ints(markers)
+
+	markerLine := func(line int) SnippetLine {
+		return SnippetLine{
+			Kind:     " ",
+			BaseLine: diff.MapNewLine(fr.Hunks, line),
+			HeadLine: line,
+			Text:     headLines[line-1],
+		}
+	}
+
+	var snippets []Snippet
+	for _, h := range fr.Hunks {
+		oldRange, hasOld := h.OldRange()
+		newRange, hasNew := h.NewRange()
+		if !(hasOld && overlapsAny(oldRange, baseViolations)) && !(hasNew && overlapsAny(newRange, headViolations)) {
+			continue
+		}
+
+		// The head lines just before and after the hunk
+		before, after := h.NewStart, h.NewStart+1
+		if hasNew {
+			before, after = newRange.Start-1, newRange.End+1
+		}
+
+		var s Snippet
+		if i := sort.SearchInts(markers, before+1) - 1; i >= 0 {
+			s.Lines = append(s.Lines, markerLine(markers[i]))
+		}
+		if hasOld {
+			s.Lines = append(s.Lines, snippetSide("-", baseLines, oldRange)...)
+		}
+		if hasNew {
+			s.Lines = append(s.Lines, snippetSide("+", headLines, newRange)...)
+		}
+		if i := sort.SearchInts(markers, after); i < len(markers) {
+			s.Lines = append(s.Lines, markerLine(markers[i]))
+		}
+		snippets = append(snippets, s)
+	}
+	return snippets
+}
+
+// snippetSide returns the lines of r, leaving out the middle of long ranges.
+func snippetSide(kind string, lines []string, r diff.LineRange) []SnippetLine {
+	var result []SnippetLine
+	n := r.End - r.Start + 1
+	for line := r.Start; line <= r.End; line++ {
+		if n > maxSnippetSide && line-r.Start >= maxSnippetSide/2 && r.End-line >= maxSnippetSide/2 {
+			continue
+		}
+		sl := SnippetLine{Kind: kind, Text: lines[line-1]}
+		if kind == "-" {
+			sl.BaseLine = line
+		} else {
+			sl.HeadLine = line
+		}
+		result = append(result, sl)
+	}
+	return result
+}
+
+// overlapsAny returns true if r shares a line with any of the ranges.
+func overlapsAny(r diff.LineRange, ranges []diff.LineRange) bool {
+	for _, o := range ranges {
+		if r.Start <= o.End && o.Start <= r.End {
+			return true
+		}
+	}
+	return false
+}
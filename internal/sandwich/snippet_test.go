@@ -0,0 +1,86 @@
+package sandwich
+
+import (
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+func TestBuildSnippets(t *testing.T) {
+	base := "a\n# START\nx\n# END\nb\nc\n"
+	head := "a\n# START\nx\n# END\nc\nnew\n"
+	headBlocks := []Block{{StartLine: 2, EndLine: 4}}
+	fr := &FileResult{
+		OutsideBase: []diff.LineRange{{Start: 5, End: 5}},
+		OutsideHead: []diff.LineRange{{Start: 6, End: 6}},
+		Hunks: []diff.Hunk{
+			{OldStart: 5, OldLines: 1, NewStart: 4, NewLines: 0},
+			{OldStart: 6, OldLines: 0, NewStart: 6, NewLines: 1},
+		},
+	}
+
+	snippets := buildSnippets(fr, base, head, headBlocks)
+	if len(snippets) != 2 {
+		t.Fatalf("expected 2 snippets, got %+v", snippets)
+	}
+
+	expected := [][]SnippetLine{
+		{
+			{Kind: " ", BaseLine: 4, HeadLine: 4, Text: "# END"},
+			{Kind: "-", BaseLine: 5, Text: "b"},
+		},
+		{
+			{Kind: " ", BaseLine: 4, HeadLine: 4, Text: "# END"},
+			{Kind: "+", HeadLine: 6, Text: "new"},
+		},
+	}
+	for i, want := range expected {
+		got := snippets[i].Lines
+		if len(got) != len(want) {
+			t.Fatalf("snippet %d: expected %+v, got %+v", i, want, got)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("snippet %d line %d: expected %+v, got %+v", i, j, want[j], got[j])
+			}
+		}
+	}
+}
+
+func TestBuildSnippets_EnclosingMarkersAndAllowedHunks(t *testing.T) {
+	base := "# START\nx\n# END\na\n# START\ny\n# END\n"
+	head := "# START\nx2\n# END\na\n# START\ny2\n# END\n"
+	headBlocks := []Block{{StartLine: 1, EndLine: 3}, {StartLine: 5, EndLine: 7}}
+	fr := &FileResult{
+		Mode:          ModeProtect,
+		ProtectedBase: []diff.LineRange{{Start: 6, End: 6}},
+		ProtectedHead: []diff.LineRange{{Start: 6, End: 6}},
+		Hunks: []diff.Hunk{
+			{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 1},
+			{OldStart: 6, OldLines: 1, NewStart: 6, NewLines: 1},
+		},
+	}
+
+	snippets := buildSnippets(fr, base, head, headBlocks)
+	if len(snippets) != 1 {
+		t.Fatalf("expected only the violating hunk, got %+v", snippets)
+	}
+	lines := snippets[0].Lines
+	if len(lines) != 4 || lines[0].Text != "# START" || lines[0].HeadLine != 5 || lines[3].Text != "# END" || lines[3].HeadLine != 7 {
+		t.Errorf("expected the hunk between its enclosing markers, got %+v", lines)
+	}
+}
+
+func TestSnippetSide_LongRange(t *testing.T) {
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "line")
+	}
+	got := snippetSide("+", lines, diff.LineRange{Start: 1, End: 30})
+	if len(got) != maxSnippetSide {
+		t.Fatalf("expected %d lines, got %d", maxSnippetSide, len(got))
+	}
+	if got[0].HeadLine != 1 || got[len(got)-1].HeadLine != 30 {
+		t.Errorf("expected the first and last lines to be kept, got %+v", got)
+	}
+}
@@ -0,0 +1,149 @@
+package sandwich
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/n0h0/git-sandwich/internal/diff"
+)
+
+// SyncConflict represents a block in the target that has no counterpart in
+// the template, so its contents cannot be carried over.
+type SyncConflict struct {
+	Rule  string         `json:"rule,omitempty"`
+	Name  string         `json:"name,omitempty"`
+	Lines diff.LineRange `json:"lines"`
+}
+
+// SyncResult represents the outcome of re-applying a template to a target.
+type SyncResult struct {
+	Content   string         `json:"-"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+}
+
+// Sync returns the template with the contents of each block replaced by the
+// contents of the matching block in target. Markers and everything outside
+// the blocks come from the template.
+//
+// Blocks are matched by name, and unnamed blocks by their order. Only
+// outermost blocks are considered; nested blocks move with their parent.
+// Every rule that matches path is applied, one after another.
+func Sync(cfg *Config, path, template, target string) (*SyncResult, error) {
+	if !shouldIncludeFile(path, cfg.IncludePatterns, cfg.ExcludePatterns) {
+		return nil, fmt.Errorf("%s is excluded by the file filters", path)
+	}
+	rules := matchingRules(cfg.rules(), path)
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rule matches %s", path)
+	}
+
+	result := &SyncResult{Content: template}
+	for _, rule := range rules {
+		content, conflicts, err := syncRule(result.Content, target, &rule)
+		if err != nil {
+			if rule.Name != "" {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			return nil, err
+		}
+		result.Content = content
+		result.Conflicts = append(result.Conflicts, conflicts...)
+	}
+	return result, nil
+}
+
+func syncRule(template, target string, rule *Rule) (string, []SyncConflict, error) {
+	templateBlocks, err := ParseBlocks(template, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
+	if err != nil {
+		return "", nil, fmt.Errorf("template: %w", err)
+	}
+	targetBlocks, err := ParseBlocks(target, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
+	if err != nil {
+		return "", nil, fmt.Errorf("target: %w", err)
+	}
+	templateBlocks = outermostBlocks(templateBlocks)
+	targetBlocks = outermostBlocks(targetBlocks)
+
+	// source[i] is the target block whose contents go into templateBlocks[i]
+	source := make([]int, len(templateBlocks))
+	for i := range source {
+		source[i] = -1
+	}
+	used := make([]bool, len(targetBlocks))
+
+	for i, tb := range templateBlocks {
+		if tb.Name == "" {
+			continue
+		}
+		for j, b := range targetBlocks {
+			if !used[j] && b.Name == tb.Name {
+				source[i], used[j] = j, true
+				break
+			}
+		}
+	}
+	j := 0
+	for i, tb := range templateBlocks {
+		if tb.Name != "" {
+			continue
+		}
+		for j < len(targetBlocks) && (used[j] || targetBlocks[j].Name != "") {
+			j++
+		}
+		if j < len(targetBlocks) {
+			source[i], used[j] = j, true
+		}
+	}
+
+	var conflicts []SyncConflict
+	for j, b := range targetBlocks {
+		if !used[j] {
+			conflicts = append(conflicts, SyncConflict{
+				Rule:  rule.Name,
+				Name:  b.Name,
+				Lines: diff.LineRange{Start: b.StartLine, End: b.EndLine},
+			})
+		}
+	}
+
+	templateLines := strings.Split(template, "\n")
+	targetLines := strings.Split(target, "\n")
+	var out []string
+	next := 1 // next template line to copy
+	for i, tb := range templateBlocks {
+		if source[i] < 0 {
+			continue
+		}
+		out = append(out, templateLines[next-1:tb.StartLine]...)
+		out = append(out, blockBody(targetLines, targetBlocks[source[i]])...)
+		next = tb.EndLine
+	}
+	out = append(out, templateLines[next-1:]...)
+
+	return strings.Join(out, "\n"), conflicts, nil
+}
+
+// outermostBlocks returns the blocks that are not nested in another block,
+// ordered by position.
+func outermostBlocks(blocks []Block) []Block {
+	var result []Block
+	for _, b := range blocks {
+		nested := false
+		for _, other := range blocks {
+			if other.StartLine < b.StartLine && b.EndLine < other.EndLine {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			result = append(result, b)
+		}
+	}
+	// ParseBlocks emits inner blocks first, but outermost blocks never
+	// overlap, so sorting by start line restores file order.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartLine < result[j].StartLine
+	})
+	return result
+}
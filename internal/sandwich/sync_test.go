@@ -0,0 +1,84 @@
+package sandwich
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func syncCfg() *Config {
+	return &Config{
+		StartMarkerRegex: regexp.MustCompile(`# START ?(?P<name>\w*)`),
+		EndMarkerRegex:   regexp.MustCompile(`# END ?(?P<name>\w*)`),
+	}
+}
+
+func TestSync_Unnamed(t *testing.T) {
+	template := "v2 header\n# START\ndefault\n# END\nv2 middle\n# START\n# END\nv2 footer\n"
+	target := "v1 header\n# START\ncustom 1\ncustom 1b\n# END\nv1 middle\n# START\ncustom 2\n# END\nv1 footer\n"
+
+	result, err := Sync(syncCfg(), "app.rb", template, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "v2 header\n# START\ncustom 1\ncustom 1b\n# END\nv2 middle\n# START\ncustom 2\n# END\nv2 footer\n"
+	if result.Content != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, result.Content)
+	}
+	if len(result.Conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %+v", result.Conflicts)
+	}
+}
+
+func TestSync_Named(t *testing.T) {
+	// Upstream reordered the blocks, added "c" and removed "old"
+	template := "# START b\n# END b\n# START a\n# END a\n# START c\nnew default\n# END c\n"
+	target := "# START a\nmine a\n# END a\n# START old\nmine old\n# END old\n# START b\nmine b\n# END b\n"
+
+	result, err := Sync(syncCfg(), "app.rb", template, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "# START b\nmine b\n# END b\n# START a\nmine a\n# END a\n# START c\nnew default\n# END c\n"
+	if result.Content != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, result.Content)
+	}
+	if len(result.Conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %+v", result.Conflicts)
+	}
+	c := result.Conflicts[0]
+	if c.Name != "old" || c.Lines.Start != 4 || c.Lines.End != 6 {
+		t.Errorf("expected conflict for old at lines 4-6, got %+v", c)
+	}
+}
+
+func TestSync_Nested(t *testing.T) {
+	cfg := syncCfg()
+	cfg.AllowNesting = true
+	template := "top\n# START outer\n# START inner\n# END inner\n# END outer\n"
+	target := "old top\n# START outer\nx\n# START inner\ny\n# END inner\n# END outer\n"
+
+	result, err := Sync(cfg, "app.rb", template, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "top\n# START outer\nx\n# START inner\ny\n# END inner\n# END outer\n"
+	if result.Content != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, result.Content)
+	}
+}
+
+func TestSync_Errors(t *testing.T) {
+	cfg := syncCfg()
+	if _, err := Sync(cfg, "app.rb", "# START\n", "x\n"); err == nil || !strings.Contains(err.Error(), "template") {
+		t.Errorf("expected template error, got %v", err)
+	}
+	if _, err := Sync(cfg, "app.rb", "x\n", "# END\n"); err == nil || !strings.Contains(err.Error(), "target") {
+		t.Errorf("expected target error, got %v", err)
+	}
+
+	cfg.ExcludePatterns = []string{"*.rb"}
+	if _, err := Sync(cfg, "app.rb", "x\n", "x\n"); err == nil {
+		t.Error("expected error for excluded file")
+	}
+}
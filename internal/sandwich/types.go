@@ -2,11 +2,16 @@ package sandwich
 
 import (
 	"regexp"
+	"runtime"
 
 	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/git"
 )
 
 // Config holds the configuration for sandwich validation.
+//
+// Files are validated against Rules. If the marker regexes on Config itself
+// are set, they form an additional unnamed rule that applies to every file.
 type Config struct {
 	StartMarkerRegex         *regexp.Regexp
 	EndMarkerRegex           *regexp.Regexp
@@ -14,17 +19,106 @@ type Config struct {
 	HeadRef                  string
 	AllowNesting             bool
 	AllowBoundaryWithOutside bool
+	Mode                     Mode
+	DenyBlockChanges         []BlockChangeKind
 	Paths                    []string
 	IncludePatterns          []string
 	ExcludePatterns          []string
+	PerCommit                bool
+	MergePolicy              MergePolicy
+	// ProtectedPaths are repository-relative paths that must not change at
+	// all, such as the policy config file itself.
+	ProtectedPaths []string
+	Rules          []Rule
+	// Snippets attaches excerpts of the violating hunks to failed results.
+	Snippets bool
+	// Repository provides diffs and file contents. Nil means the git
+	// command is run for each of them.
+	Repository git.Repository
+	// Jobs is the number of files validated in parallel. Zero means
+	// runtime.GOMAXPROCS(0).
+	Jobs int
 }
 
+// Rule is a named set of block markers and flags. A file is validated against
+// every rule whose include/exclude patterns match its path.
+type Rule struct {
+	Name                     string
+	StartMarkerRegex         *regexp.Regexp
+	EndMarkerRegex           *regexp.Regexp
+	AllowNesting             bool
+	AllowBoundaryWithOutside bool
+	Mode                     Mode
+	DenyBlockChanges         []BlockChangeKind
+	IncludePatterns          []string
+	ExcludePatterns          []string
+}
+
+// Mode determines which side of the block markers may be edited.
+type Mode string
+
+const (
+	// ModeAllow allows changes inside blocks and rejects changes outside them.
+	// The zero value is treated as ModeAllow.
+	ModeAllow Mode = "allow"
+	// ModeProtect rejects changes inside blocks, including the markers
+	// themselves, and allows changes outside them.
+	ModeProtect Mode = "protect"
+)
+
+// rules returns the unnamed default rule, if configured, followed by Rules.
+func (c *Config) rules() []Rule {
+	if c.StartMarkerRegex == nil || c.EndMarkerRegex == nil {
+		return c.Rules
+	}
+	defaultRule := Rule{
+		StartMarkerRegex:         c.StartMarkerRegex,
+		EndMarkerRegex:           c.EndMarkerRegex,
+		AllowNesting:             c.AllowNesting,
+		AllowBoundaryWithOutside: c.AllowBoundaryWithOutside,
+		Mode:                     c.Mode,
+		DenyBlockChanges:         c.DenyBlockChanges,
+	}
+	return append([]Rule{defaultRule}, c.Rules...)
+}
+
+// Repo returns the repository to read diffs, file contents and history from:
+// Repository, or the git command if it is nil.
+func (c *Config) Repo() git.Repository {
+	if c.Repository == nil {
+		return git.ExecRepository{}
+	}
+	return c.Repository
+}
+
+// jobs returns the number of files to validate in parallel.
+func (c *Config) jobs() int {
+	if c.Jobs <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return c.Jobs
+}
+
+// MergePolicy controls how merge commits are validated in per-commit mode.
+type MergePolicy string
+
+const (
+	// MergeSkip skips merge commits entirely.
+	MergeSkip MergePolicy = "skip"
+	// MergeFirstParent validates a merge commit against its first parent only.
+	MergeFirstParent MergePolicy = "first-parent"
+	// MergeAllParents validates a merge commit against each of its parents.
+	MergeAllParents MergePolicy = "all-parents"
+)
+
 // Block represents a BEGIN/END sandwich block.
 // StartLine is the line number of the BEGIN marker.
 // EndLine is the line number of the END marker.
+// Name is the "name" capture group of the BEGIN marker, if any.
 type Block struct {
 	StartLine int
 	EndLine   int
+	Name      string
 }
 
 // ContainsLine returns true if the given line is inside the block
@@ -38,19 +132,84 @@ func (b Block) IsBoundary(line int) bool {
 	return line == b.StartLine || line == b.EndLine
 }
 
+// BlockChangeKind describes how a block differs between base and head.
+type BlockChangeKind string
+
+const (
+	BlockAdded   BlockChangeKind = "added"
+	BlockDeleted BlockChangeKind = "deleted"
+	BlockRenamed BlockChangeKind = "renamed"
+	BlockMoved   BlockChangeKind = "moved"
+	BlockResized BlockChangeKind = "resized"
+)
+
+// BlockChange represents a single block-level change between base and head.
+// Base and Head are the marker lines of the block on each side; one of them
+// is nil for added and deleted blocks.
+type BlockChange struct {
+	Kind    BlockChangeKind `json:"kind"`
+	Name    string          `json:"name,omitempty"`
+	OldName string          `json:"old_name,omitempty"`
+	Base    *diff.LineRange `json:"base,omitempty"`
+	Head    *diff.LineRange `json:"head,omitempty"`
+	Denied  bool            `json:"denied,omitempty"`
+}
+
 // FileResult represents the validation result for a single file.
 type FileResult struct {
 	Path            string           `json:"path"`
+	OldPath         string           `json:"old_path,omitempty"`
+	Commit          string           `json:"commit,omitempty"`
+	Rule            string           `json:"rule,omitempty"`
+	Mode            Mode             `json:"mode,omitempty"`
 	Success         bool             `json:"success"`
 	OutsideBase     []diff.LineRange `json:"outside_base,omitempty"`
 	OutsideHead     []diff.LineRange `json:"outside_head,omitempty"`
+	ProtectedBase   []diff.LineRange `json:"protected_base,omitempty"`
+	ProtectedHead   []diff.LineRange `json:"protected_head,omitempty"`
 	BoundaryChanged bool             `json:"boundary_changed,omitempty"`
-	BlockError      string           `json:"block_error,omitempty"`
+	BlockChanges    []BlockChange    `json:"block_changes,omitempty"`
+	BlockErrors     []BlockError     `json:"block_errors,omitempty"`
+	PolicyError     string           `json:"policy_error,omitempty"`
 	SkipReason      string           `json:"skip_reason,omitempty"`
+	Snippets        []Snippet        `json:"snippets,omitempty"`
+	RangeBlocks     []RangeBlock     `json:"range_blocks,omitempty"`
+
+	// Hunks are the changes from base to head, used to map base line
+	// numbers to head line numbers. Nil if no diff was involved.
+	Hunks []diff.Hunk `json:"-"`
+}
+
+// RangeBlock names the block a violating range of lines is in or, for a
+// range outside blocks, the block nearest to it. Side is "base" or "head",
+// as in OutsideBase and OutsideHead.
+type RangeBlock struct {
+	Side  string         `json:"side"`
+	Lines diff.LineRange `json:"lines"`
+	Name  string         `json:"name"`
+}
+
+// Snippet is an excerpt of one violating hunk, together with the nearest
+// block markers before and after it.
+type Snippet struct {
+	Lines []SnippetLine `json:"lines"`
+}
+
+// SnippetLine is a line of a snippet. Kind is "-" for a line that only exists
+// in the base, "+" for a line that only exists in the head and " " for an
+// unchanged marker line. The line number on the side a line does not exist
+// in is 0. Lines may be left out between two snippet lines; this shows as a
+// gap in their line numbers.
+type SnippetLine struct {
+	Kind     string `json:"kind"`
+	BaseLine int    `json:"base_line,omitempty"`
+	HeadLine int    `json:"head_line,omitempty"`
+	Text     string `json:"text"`
 }
 
 // Result represents the overall validation result.
 type Result struct {
 	Success bool         `json:"success"`
+	Commits []string     `json:"commits,omitempty"`
 	Files   []FileResult `json:"files"`
 }
@@ -1,15 +1,86 @@
 package sandwich
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/n0h0/git-sandwich/internal/diff"
 	"github.com/n0h0/git-sandwich/internal/git"
 )
 
-// Validate performs the sandwich validation based on the given config.
-func Validate(cfg *Config) (*Result, error) {
-	diffBytes, err := git.GetDiff(cfg.BaseRef, cfg.HeadRef, cfg.Paths)
+// Validate performs the sandwich validation based on the given config. It
+// stops validating files once ctx is done and returns the context's error.
+func Validate(ctx context.Context, cfg *Config) (*Result, error) {
+	if cfg.PerCommit {
+		return validateCommits(ctx, cfg)
+	}
+	return validateRange(ctx, cfg)
+}
+
+// validateCommits validates each commit in base..head against its parent.
+// The file results of every commit are collected into a single result, each
+// tagged with the commit that produced it. Commits lists every commit walked,
+// including skipped merges.
+func validateCommits(ctx context.Context, cfg *Config) (*Result, error) {
+	if git.IsPseudoRef(cfg.HeadRef) {
+		return nil, fmt.Errorf("per-commit validation requires a commit as head ref")
+	}
+
+	commits, err := cfg.Repo().ListCommits(ctx, cfg.BaseRef, cfg.HeadRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+
+	result := &Result{Success: true}
+	for _, c := range commits {
+		result.Commits = append(result.Commits, c.SHA)
+		for _, parent := range commitParents(c, cfg.MergePolicy) {
+			commitCfg := *cfg
+			commitCfg.BaseRef = parent
+			commitCfg.HeadRef = c.SHA
+
+			cr, err := validateRange(ctx, &commitCfg)
+			if err != nil {
+				return nil, fmt.Errorf("commit %s: %w", c.SHA, err)
+			}
+			for _, fr := range cr.Files {
+				fr.Commit = c.SHA
+				result.Files = append(result.Files, fr)
+			}
+			if !cr.Success {
+				result.Success = false
+			}
+		}
+	}
+	return result, nil
+}
+
+// commitParents returns the parents a commit should be validated against.
+// Root commits are validated against the empty tree.
+func commitParents(c git.Commit, policy MergePolicy) []string {
+	switch len(c.Parents) {
+	case 0:
+		return []string{git.EmptyTree}
+	case 1:
+		return c.Parents
+	}
+	switch policy {
+	case MergeFirstParent:
+		return c.Parents[:1]
+	case MergeAllParents:
+		return c.Parents
+	}
+	return nil
+}
+
+// validateRange validates the squashed diff between the base and head refs.
+func validateRange(ctx context.Context, cfg *Config) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	diffBytes, err := cfg.Repo().GetDiff(ctx, cfg.BaseRef, cfg.HeadRef, cfg.Paths)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get diff: %w", err)
 	}
@@ -23,11 +94,42 @@ func Validate(cfg *Config) (*Result, error) {
 		return nil, fmt.Errorf("failed to parse diff: %w", err)
 	}
 
-	fileDiffs = filterFiles(fileDiffs, cfg.IncludePatterns, cfg.ExcludePatterns)
-
 	result := &Result{Success: true}
+
+	// Protected paths are checked before filtering so that include/exclude
+	// patterns cannot hide a policy change.
+	var unprotected []diff.FileDiff
 	for _, fd := range fileDiffs {
-		fr := validateFile(cfg, &fd)
+		if fr, ok := checkProtected(cfg, &fd); ok {
+			result.Files = append(result.Files, fr)
+			result.Success = false
+			continue
+		}
+		unprotected = append(unprotected, fd)
+	}
+
+	fileDiffs = filterFiles(unprotected, cfg.IncludePatterns, cfg.ExcludePatterns)
+
+	var tasks []fileTask
+	rules := cfg.rules()
+	for i := range fileDiffs {
+		matched := matchingRules(rules, diffPath(&fileDiffs[i]))
+		if len(matched) == 0 {
+			tasks = append(tasks, fileTask{fd: &fileDiffs[i]})
+		}
+		for j := range matched {
+			tasks = append(tasks, fileTask{fd: &fileDiffs[i], rule: &matched[j]})
+		}
+	}
+	if err := prefetch(ctx, cfg, tasks); err != nil {
+		return nil, fmt.Errorf("failed to read files: %w", err)
+	}
+
+	frs, err := validateFiles(ctx, cfg, tasks)
+	if err != nil {
+		return nil, err
+	}
+	for _, fr := range frs {
 		result.Files = append(result.Files, fr)
 		if !fr.Success {
 			result.Success = false
@@ -36,77 +138,165 @@ func Validate(cfg *Config) (*Result, error) {
 	return result, nil
 }
 
-func validateFile(cfg *Config, fd *diff.FileDiff) FileResult {
-	path := fd.NewPath
-	if fd.IsDeleted {
-		path = fd.OldPath
-	}
+// fileTask is a file diff to validate against a rule. A nil rule means
+// no rule matches the file.
+type fileTask struct {
+	fd   *diff.FileDiff
+	rule *Rule
+}
 
-	fr := FileResult{Path: path, Success: true}
+// validateFiles validates the tasks with up to cfg.Jobs workers and returns
+// the results in task order. No more tasks are started once ctx is done.
+func validateFiles(ctx context.Context, cfg *Config, tasks []fileTask) ([]FileResult, error) {
+	results := make([]FileResult, len(tasks))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(cfg.jobs(), len(tasks)) {
+		wg.Go(func() {
+			for i := range next {
+				if tasks[i].rule == nil {
+					results[i] = FileResult{Path: diffPath(tasks[i].fd), Success: true, SkipReason: "no matching rule"}
+					continue
+				}
+				results[i] = validateFile(ctx, cfg, tasks[i].rule, tasks[i].fd)
+			}
+		})
+	}
+send:
+	for i := range tasks {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
 
-	// New file: skip (only validate block structure in head)
-	if fd.IsNew {
-		content, exists, err := git.GetFileContent(cfg.HeadRef, fd.NewPath)
-		if err != nil || !exists {
-			fr.SkipReason = "new file"
-			return fr
+// prefetch reads the base and head files of every task in one go, if the
+// repository supports it.
+func prefetch(ctx context.Context, cfg *Config, tasks []fileTask) error {
+	p, ok := cfg.Repo().(git.Prefetcher)
+	if !ok {
+		return nil
+	}
+	var files []git.FileRef
+	for _, t := range tasks {
+		if t.rule == nil {
+			continue
 		}
-		if HasBlocks(content, cfg.StartMarkerRegex, cfg.EndMarkerRegex) {
-			_, blockErr := ParseBlocks(content, cfg.StartMarkerRegex, cfg.EndMarkerRegex, cfg.AllowNesting)
-			if blockErr != nil {
-				fr.Success = false
-				fr.BlockError = blockErr.Error()
-				return fr
-			}
+		fd := t.fd
+		if !fd.IsNew {
+			files = append(files, git.FileRef{Ref: cfg.BaseRef, Path: fd.OldPath})
 		}
-		fr.SkipReason = "new file"
-		return fr
+		if !fd.IsDeleted {
+			files = append(files, git.FileRef{Ref: cfg.HeadRef, Path: fd.NewPath})
+		}
+	}
+	return p.Prefetch(ctx, files)
+}
+
+// checkProtected returns a failing result if the diff touches a protected path.
+func checkProtected(cfg *Config, fd *diff.FileDiff) (FileResult, bool) {
+	for _, p := range cfg.ProtectedPaths {
+		if (!fd.IsNew && fd.OldPath == p) || (!fd.IsDeleted && fd.NewPath == p) {
+			return FileResult{
+				Path:        p,
+				Success:     false,
+				PolicyError: "policy config changed",
+			}, true
+		}
+	}
+	return FileResult{}, false
+}
+
+func validateFile(ctx context.Context, cfg *Config, rule *Rule, fd *diff.FileDiff) FileResult {
+	fr := FileResult{Path: diffPath(fd), Rule: rule.Name, Success: true, Hunks: fd.Hunks}
+	if rule.Mode == ModeProtect {
+		fr.Mode = ModeProtect
+	}
+	if !fd.IsNew && !fd.IsDeleted && fd.OldPath != fd.NewPath {
+		fr.OldPath = fd.OldPath
+	}
+
+	// New file: skip (only validate block structure and added blocks in head)
+	if fd.IsNew {
+		return checkAddedBlocks(ctx, cfg, rule, fd, fr, "new file")
 	}
 
 	// Get base content
-	baseContent, baseExists, err := git.GetFileContent(cfg.BaseRef, fd.OldPath)
+	baseContent, baseExists, err := cfg.Repo().GetFileContent(ctx, cfg.BaseRef, fd.OldPath)
 	if err != nil {
-		fr.Success = false
-		fr.BlockError = fmt.Sprintf("failed to read base file: %v", err)
+		fr.addBlockError("base", fmt.Errorf("failed to read file: %w", err))
 		return fr
 	}
 
 	// If base file doesn't exist or has no blocks, skip
-	if !baseExists || !HasBlocks(baseContent, cfg.StartMarkerRegex, cfg.EndMarkerRegex) {
-		fr.SkipReason = "no blocks in base"
-		return fr
+	if !baseExists || !HasBlocks(baseContent, rule.StartMarkerRegex, rule.EndMarkerRegex) {
+		if fd.IsDeleted {
+			fr.SkipReason = "no blocks in base"
+			return fr
+		}
+		return checkAddedBlocks(ctx, cfg, rule, fd, fr, "no blocks in base")
 	}
 
 	// Parse base blocks
-	baseBlocks, baseBlockErr := ParseBlocks(baseContent, cfg.StartMarkerRegex, cfg.EndMarkerRegex, cfg.AllowNesting)
+	baseBlocks, baseBlockErr := ParseBlocks(baseContent, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
 	if baseBlockErr != nil {
-		fr.Success = false
-		fr.BlockError = fmt.Sprintf("base: %v", baseBlockErr)
+		fr.addBlockError("base", baseBlockErr)
 		return fr
 	}
 
 	// Deleted file: check all deleted ranges against base blocks
 	if fd.IsDeleted {
-		outsideBase := findOutsideLines(fd.OldRanges, baseBlocks)
-		if len(outsideBase) > 0 {
+		fr.BlockChanges = applyBlockPolicy(deletedBlocks(baseBlocks), rule.DenyBlockChanges)
+		if rule.Mode == ModeProtect {
+			fr.ProtectedBase = findProtectedLines(fd.OldRanges, baseBlocks)
+		} else {
+			fr.OutsideBase = findOutsideLines(fd.OldRanges, baseBlocks)
+		}
+		if len(fr.ProtectedBase) > 0 || len(fr.OutsideBase) > 0 || hasDeniedChange(fr.BlockChanges) {
 			fr.Success = false
-			fr.OutsideBase = outsideBase
 		}
+		fr.nameRanges(baseBlocks, nil)
+		attachSnippets(cfg, &fr, baseContent, "", nil)
 		return fr
 	}
 
 	// Normal file: get head content and parse blocks
-	headContent, headExists, err := git.GetFileContent(cfg.HeadRef, fd.NewPath)
-	if err != nil || !headExists {
-		fr.Success = false
-		fr.BlockError = "failed to read head file"
+	headContent, headExists, err := cfg.Repo().GetFileContent(ctx, cfg.HeadRef, fd.NewPath)
+	if err != nil {
+		fr.addBlockError("head", fmt.Errorf("failed to read file: %w", err))
+		return fr
+	}
+	if !headExists {
+		fr.addBlockError("head", errors.New("failed to read file"))
 		return fr
 	}
 
-	headBlocks, headBlockErr := ParseBlocks(headContent, cfg.StartMarkerRegex, cfg.EndMarkerRegex, cfg.AllowNesting)
+	headBlocks, headBlockErr := ParseBlocks(headContent, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
 	if headBlockErr != nil {
-		fr.Success = false
-		fr.BlockError = fmt.Sprintf("head: %v", headBlockErr)
+		fr.addBlockError("head", headBlockErr)
+		return fr
+	}
+
+	fr.BlockChanges = applyBlockPolicy(MatchBlocks(baseContent, baseBlocks, headContent, headBlocks), rule.DenyBlockChanges)
+	deniedChange := hasDeniedChange(fr.BlockChanges)
+
+	// Protect mode: any change inside a block or to its markers is rejected
+	if rule.Mode == ModeProtect {
+		fr.ProtectedBase = findProtectedLines(fd.OldRanges, baseBlocks)
+		fr.ProtectedHead = findProtectedLines(fd.NewRanges, headBlocks)
+		if len(fr.ProtectedBase) > 0 || len(fr.ProtectedHead) > 0 || deniedChange {
+			fr.Success = false
+		}
+		fr.nameRanges(baseBlocks, headBlocks)
+		attachSnippets(cfg, &fr, baseContent, headContent, headBlocks)
 		return fr
 	}
 
@@ -121,64 +311,151 @@ func validateFile(cfg *Config, fd *diff.FileDiff) FileResult {
 	hasOutside := len(outsideBase) > 0 || len(outsideHead) > 0
 
 	if hasOutside {
-		if fr.BoundaryChanged && cfg.AllowBoundaryWithOutside {
+		if fr.BoundaryChanged && rule.AllowBoundaryWithOutside {
 			fr.Success = true
 		} else {
 			fr.Success = false
 		}
 	}
+	if deniedChange {
+		fr.Success = false
+	}
+	fr.nameRanges(baseBlocks, headBlocks)
+	attachSnippets(cfg, &fr, baseContent, headContent, headBlocks)
 
 	return fr
 }
 
-// classifyLines categorizes each line in the ranges as outside or boundary.
-// Lines that are inside blocks are simply ignored (they're OK).
-func classifyLines(ranges []diff.LineRange, blocks []Block) (outside []diff.LineRange, boundary []diff.LineRange) {
-	for _, r := range ranges {
-		for line := r.Start; line <= r.End; line++ {
-			classification := classifyLine(line, blocks)
-			switch classification {
-			case "outside":
-				outside = appendOrExtend(outside, line)
-			case "boundary":
-				boundary = appendOrExtend(boundary, line)
+// checkAddedBlocks validates the head version of a file without blocks in
+// base: its block structure, and its blocks as added block changes. The file
+// is skipped with the given reason unless either of them fails it.
+func checkAddedBlocks(ctx context.Context, cfg *Config, rule *Rule, fd *diff.FileDiff, fr FileResult, reason string) FileResult {
+	content, exists, err := cfg.Repo().GetFileContent(ctx, cfg.HeadRef, fd.NewPath)
+	if err != nil || !exists || !HasBlocks(content, rule.StartMarkerRegex, rule.EndMarkerRegex) {
+		fr.SkipReason = reason
+		return fr
+	}
+	blocks, blockErr := ParseBlocks(content, rule.StartMarkerRegex, rule.EndMarkerRegex, rule.AllowNesting)
+	if blockErr != nil {
+		fr.addBlockError("head", blockErr)
+		return fr
+	}
+	fr.BlockChanges = applyBlockPolicy(addedBlocks(blocks), rule.DenyBlockChanges)
+	if hasDeniedChange(fr.BlockChanges) {
+		fr.Success = false
+		return fr
+	}
+	fr.SkipReason = reason
+	return fr
+}
+
+// applyBlockPolicy marks the block changes whose kind is denied.
+func applyBlockPolicy(changes []BlockChange, deny []BlockChangeKind) []BlockChange {
+	for i := range changes {
+		for _, kind := range deny {
+			if changes[i].Kind == kind {
+				changes[i].Denied = true
+				break
 			}
 		}
 	}
-	return
+	return changes
 }
 
-// classifyLine classifies a single line number against the blocks.
-func classifyLine(line int, blocks []Block) string {
-	for _, b := range blocks {
-		if b.ContainsLine(line) {
-			return "inside"
-		}
-		if b.IsBoundary(line) {
-			return "boundary"
+// hasDeniedChange returns true if any of the block changes is denied.
+func hasDeniedChange(changes []BlockChange) bool {
+	for _, c := range changes {
+		if c.Denied {
+			return true
 		}
 	}
-	return "outside"
+	return false
+}
+
+// classifyLines categorizes each line in the ranges as outside or boundary.
+// Lines that are inside blocks are simply ignored (they're OK).
+func classifyLines(ranges []diff.LineRange, blocks []Block) (outside []diff.LineRange, boundary []diff.LineRange) {
+	idx := newBlockIndex(blocks)
+	for _, r := range ranges {
+		idx.classify(r, func(part diff.LineRange, class string) {
+			switch class {
+			case lineOutside:
+				outside = appendRange(outside, part)
+			case lineBoundary:
+				boundary = appendRange(boundary, part)
+			}
+		})
+	}
+	return
 }
 
 // findOutsideLines returns ranges of lines that are outside all blocks.
 func findOutsideLines(ranges []diff.LineRange, blocks []Block) []diff.LineRange {
-	var outside []diff.LineRange
+	outside, _ := classifyLines(ranges, blocks)
+	return outside
+}
+
+// findProtectedLines returns ranges of lines that are inside a block or on
+// one of its markers.
+func findProtectedLines(ranges []diff.LineRange, blocks []Block) []diff.LineRange {
+	var protected []diff.LineRange
+	idx := newBlockIndex(blocks)
 	for _, r := range ranges {
-		for line := r.Start; line <= r.End; line++ {
-			isInside := false
-			for _, b := range blocks {
-				if b.ContainsLine(line) || b.IsBoundary(line) {
-					isInside = true
-					break
-				}
+		idx.classify(r, func(part diff.LineRange, class string) {
+			if class != lineOutside {
+				protected = appendRange(protected, part)
 			}
-			if !isInside {
-				outside = appendOrExtend(outside, line)
+		})
+	}
+	return protected
+}
+
+// nameRanges records the name of the block each violating range is in or
+// nearest to, on each side. Ranges whose block is unnamed are left out.
+func (fr *FileResult) nameRanges(baseBlocks, headBlocks []Block) {
+	add := func(side string, ranges []diff.LineRange, blocks []Block) {
+		for _, r := range ranges {
+			if name := rangeBlockName(r, blocks); name != "" {
+				fr.RangeBlocks = append(fr.RangeBlocks, RangeBlock{Side: side, Lines: r, Name: name})
 			}
 		}
 	}
-	return outside
+	add("base", fr.OutsideBase, baseBlocks)
+	add("base", fr.ProtectedBase, baseBlocks)
+	add("head", fr.OutsideHead, headBlocks)
+	add("head", fr.ProtectedHead, headBlocks)
+}
+
+// rangeBlockName returns the name of the innermost block around the first
+// line of r, counting its markers, or else of the block closest to r. Of two
+// blocks equally close, the one that ends first wins.
+func rangeBlockName(r diff.LineRange, blocks []Block) string {
+	nearest, best := "", -1
+	for _, b := range blocks {
+		var distance int
+		switch {
+		case r.Start >= b.StartLine && r.Start <= b.EndLine:
+			return b.Name
+		case b.EndLine < r.Start:
+			distance = r.Start - b.EndLine
+		default:
+			distance = b.StartLine - r.End
+		}
+		if best < 0 || distance < best {
+			nearest, best = b.Name, distance
+		}
+	}
+	return nearest
+}
+
+// appendRange appends a range of lines to the ranges, extending the last
+// range if contiguous.
+func appendRange(ranges []diff.LineRange, r diff.LineRange) []diff.LineRange {
+	if len(ranges) > 0 && ranges[len(ranges)-1].End == r.Start-1 {
+		ranges[len(ranges)-1].End = r.End
+		return ranges
+	}
+	return append(ranges, r)
 }
 
 // appendOrExtend appends a line to the ranges, extending the last range if contiguous.
@@ -1,34 +1,37 @@
 package sandwich
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/n0h0/git-sandwich/internal/diff"
 )
 
-func TestClassifyLine_Inside(t *testing.T) {
+func TestLineClass_Inside(t *testing.T) {
 	blocks := []Block{{StartLine: 5, EndLine: 10}}
-	if got := classifyLine(7, blocks); got != "inside" {
+	if got := newBlockIndex(blocks).lineClass(7); got != "inside" {
 		t.Errorf("expected inside, got %s", got)
 	}
 }
 
-func TestClassifyLine_Boundary(t *testing.T) {
+func TestLineClass_Boundary(t *testing.T) {
 	blocks := []Block{{StartLine: 5, EndLine: 10}}
-	if got := classifyLine(5, blocks); got != "boundary" {
+	if got := newBlockIndex(blocks).lineClass(5); got != "boundary" {
 		t.Errorf("expected boundary for START, got %s", got)
 	}
-	if got := classifyLine(10, blocks); got != "boundary" {
+	if got := newBlockIndex(blocks).lineClass(10); got != "boundary" {
 		t.Errorf("expected boundary for END, got %s", got)
 	}
 }
 
-func TestClassifyLine_Outside(t *testing.T) {
+func TestLineClass_Outside(t *testing.T) {
 	blocks := []Block{{StartLine: 5, EndLine: 10}}
-	if got := classifyLine(3, blocks); got != "outside" {
+	if got := newBlockIndex(blocks).lineClass(3); got != "outside" {
 		t.Errorf("expected outside, got %s", got)
 	}
-	if got := classifyLine(12, blocks); got != "outside" {
+	if got := newBlockIndex(blocks).lineClass(12); got != "outside" {
 		t.Errorf("expected outside, got %s", got)
 	}
 }
@@ -109,3 +112,158 @@ func TestClassifyLines_MultipleBlocks(t *testing.T) {
 		t.Errorf("expected no outside for inside lines, got %+v", outside)
 	}
 }
+
+func TestFindProtectedLines(t *testing.T) {
+	blocks := []Block{{StartLine: 5, EndLine: 10}}
+
+	ranges := []diff.LineRange{{Start: 3, End: 6}, {Start: 9, End: 12}}
+	protected := findProtectedLines(ranges, blocks)
+	if len(protected) != 2 {
+		t.Fatalf("expected 2 protected ranges, got %+v", protected)
+	}
+	if protected[0].Start != 5 || protected[0].End != 6 {
+		t.Errorf("expected protected[0] {5,6}, got %+v", protected[0])
+	}
+	if protected[1].Start != 9 || protected[1].End != 10 {
+		t.Errorf("expected protected[1] {9,10}, got %+v", protected[1])
+	}
+
+	ranges = []diff.LineRange{{Start: 1, End: 4}, {Start: 11, End: 12}}
+	if protected := findProtectedLines(ranges, blocks); len(protected) != 0 {
+		t.Errorf("expected no protected lines, got %+v", protected)
+	}
+}
+
+func TestRangeBlockName(t *testing.T) {
+	blocks := []Block{
+		{StartLine: 4, EndLine: 6, Name: "inner"},
+		{StartLine: 3, EndLine: 10, Name: "outer"},
+		{StartLine: 20, EndLine: 25, Name: "late"},
+		{StartLine: 40, EndLine: 45},
+	}
+	tests := []struct {
+		r    diff.LineRange
+		want string
+	}{
+		{diff.LineRange{Start: 5, End: 5}, "inner"},
+		{diff.LineRange{Start: 8, End: 9}, "outer"},
+		{diff.LineRange{Start: 3, End: 3}, "outer"},
+		{diff.LineRange{Start: 1, End: 1}, "outer"},
+		{diff.LineRange{Start: 17, End: 18}, "late"},
+		{diff.LineRange{Start: 15, End: 15}, "outer"},
+		{diff.LineRange{Start: 42, End: 42}, ""},
+	}
+	for _, tt := range tests {
+		if got := rangeBlockName(tt.r, blocks); got != tt.want {
+			t.Errorf("rangeBlockName(%+v) = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
+
+// naiveClassifyLines classifies the ranges one line at a time, scanning every
+// block for every line. It is the reference for the block index.
+func naiveClassifyLines(ranges []diff.LineRange, blocks []Block) (outside, boundary, protected []diff.LineRange) {
+	for _, r := range ranges {
+		for line := r.Start; line <= r.End; line++ {
+			class := lineOutside
+			for _, b := range blocks {
+				if b.ContainsLine(line) {
+					class = lineInside
+					break
+				}
+				if b.IsBoundary(line) {
+					class = lineBoundary
+					break
+				}
+			}
+			switch class {
+			case lineOutside:
+				outside = appendOrExtend(outside, line)
+			case lineBoundary:
+				boundary = appendOrExtend(boundary, line)
+				protected = appendOrExtend(protected, line)
+			default:
+				protected = appendOrExtend(protected, line)
+			}
+		}
+	}
+	return
+}
+
+// randomBlocks returns up to n blocks in the order ParseBlocks returns them,
+// nested or not.
+func randomBlocks(rng *rand.Rand, n, lines int) []Block {
+	var blocks []Block
+	var open []int
+	for line := 1; line <= lines && len(blocks) < n; line++ {
+		switch {
+		case len(open) > 0 && rng.Intn(4) == 0:
+			blocks = append(blocks, Block{StartLine: open[len(open)-1], EndLine: line})
+			open = open[:len(open)-1]
+		case rng.Intn(4) == 0:
+			open = append(open, line)
+		}
+	}
+	return blocks
+}
+
+func TestBlockIndex_MatchesNaive(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := range 2000 {
+		lines := 1 + rng.Intn(60)
+		blocks := randomBlocks(rng, rng.Intn(8), lines)
+		if i%2 == 0 {
+			// Arbitrary overlapping blocks in any order
+			blocks = nil
+			for range rng.Intn(6) {
+				start := 1 + rng.Intn(lines)
+				blocks = append(blocks, Block{StartLine: start, EndLine: start + rng.Intn(lines)})
+			}
+		}
+		var ranges []diff.LineRange
+		for range rng.Intn(5) {
+			start := 1 + rng.Intn(lines)
+			ranges = append(ranges, diff.LineRange{Start: start, End: start + rng.Intn(10) - 1})
+		}
+
+		wantOutside, wantBoundary, wantProtected := naiveClassifyLines(ranges, blocks)
+		outside, boundary := classifyLines(ranges, blocks)
+		protected := findProtectedLines(ranges, blocks)
+		if !reflect.DeepEqual(outside, wantOutside) || !reflect.DeepEqual(boundary, wantBoundary) {
+			t.Fatalf("classifyLines(%+v, %+v):\nexpected %+v %+v\ngot      %+v %+v",
+				ranges, blocks, wantOutside, wantBoundary, outside, boundary)
+		}
+		if got := findOutsideLines(ranges, blocks); !reflect.DeepEqual(got, wantOutside) {
+			t.Fatalf("findOutsideLines(%+v, %+v): expected %+v, got %+v", ranges, blocks, wantOutside, got)
+		}
+		if !reflect.DeepEqual(protected, wantProtected) {
+			t.Fatalf("findProtectedLines(%+v, %+v): expected %+v, got %+v", ranges, blocks, wantProtected, protected)
+		}
+	}
+}
+
+// BenchmarkClassifyLines classifies a rewrite of a whole 100k line file with
+// hundreds of blocks, one line at a time and through the block index.
+func BenchmarkClassifyLines(b *testing.B) {
+	const lines = 100000
+	for _, n := range []int{100, 500} {
+		var blocks []Block
+		for i := range n {
+			start := 1 + i*lines/n
+			blocks = append(blocks, Block{StartLine: start, EndLine: start + lines/n/2})
+		}
+		ranges := []diff.LineRange{{Start: 1, End: lines}}
+
+		b.Run(fmt.Sprintf("naive/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				naiveClassifyLines(ranges, blocks)
+			}
+		})
+		b.Run(fmt.Sprintf("index/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				classifyLines(ranges, blocks)
+				findProtectedLines(ranges, blocks)
+			}
+		})
+	}
+}
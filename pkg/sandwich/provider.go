@@ -0,0 +1,130 @@
+package sandwich
+
+import (
+	"context"
+	"io"
+
+	"github.com/n0h0/git-sandwich/internal/git"
+)
+
+// Pseudo-refs accepted as Options.HeadRef.
+const (
+	// StagedRef validates the content staged in the index.
+	StagedRef = git.StagedRef
+	// WorktreeRef validates the files in the working tree.
+	WorktreeRef = git.WorktreeRef
+)
+
+// DiffProvider provides the changes to validate.
+type DiffProvider interface {
+	// Diff returns the changes from the merge base of baseRef and headRef
+	// to headRef, limited to paths if any are given, as a unified diff
+	// with no context lines (git diff -U0) and rename detection. For
+	// StagedRef and WorktreeRef the merge base of baseRef and HEAD is used.
+	Diff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error)
+}
+
+// ContentProvider provides file contents.
+type ContentProvider interface {
+	// FileContent returns the content of the file at path, relative to the
+	// repository root, as of ref, and whether the file exists there.
+	FileContent(ctx context.Context, ref, path string) (content string, exists bool, err error)
+}
+
+// Names of the Git backends accepted by NewGit.
+const (
+	// BackendExec runs the git command for every request.
+	BackendExec = git.BackendExec
+	// BackendBatch runs the git command for diffs and reads files through
+	// one git cat-file --batch process.
+	BackendBatch = git.BackendBatch
+	// BackendGoGit reads objects and computes diffs in process.
+	BackendGoGit = git.BackendGoGit
+)
+
+// Git is a DiffProvider and ContentProvider for the Git repository containing
+// the current directory. The git processes a request runs are killed when
+// its context is done; the go-git backend, which runs none, checks the
+// context as it goes.
+type Git struct {
+	repo git.Repository
+}
+
+// NewGit returns a Git that accesses the repository through the named
+// backend.
+func NewGit(backend string) (*Git, error) {
+	repo, err := git.Open(backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Git{repo: repo}, nil
+}
+
+// Diff implements DiffProvider.
+func (g *Git) Diff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error) {
+	return g.repo.GetDiff(ctx, baseRef, headRef, paths)
+}
+
+// FileContent implements ContentProvider.
+func (g *Git) FileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	return g.repo.GetFileContent(ctx, ref, path)
+}
+
+// Close releases the processes the backend keeps running, if any.
+func (g *Git) Close() error {
+	if c, ok := g.repo.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// providers adapts a DiffProvider and a ContentProvider to the repository
+// the validator reads from. Commits are listed by the embedded repository,
+// that of the DiffProvider, which Validate requires to be a Git in
+// per-commit mode.
+type providers struct {
+	git.Repository
+	diff    DiffProvider
+	content ContentProvider
+}
+
+// repository returns the repository for the providers. Nil providers run the
+// git command.
+func repository(d DiffProvider, c ContentProvider) git.Repository {
+	if d == nil || c == nil {
+		exec := &Git{repo: git.ExecRepository{}}
+		if d == nil {
+			d = exec
+		}
+		if c == nil {
+			c = exec
+		}
+	}
+	var repo git.Repository = git.ExecRepository{}
+	if g, ok := d.(*Git); ok {
+		repo = g.repo
+	}
+	return providers{Repository: repo, diff: d, content: c}
+}
+
+func (p providers) GetDiff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error) {
+	return p.diff.Diff(ctx, baseRef, headRef, paths)
+}
+
+func (p providers) GetFileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	return p.content.FileContent(ctx, ref, path)
+}
+
+// Prefetch passes the files on to a Git backend that reads many files at
+// once.
+func (p providers) Prefetch(ctx context.Context, files []git.FileRef) error {
+	g, ok := p.content.(*Git)
+	if !ok {
+		return nil
+	}
+	pf, ok := g.repo.(git.Prefetcher)
+	if !ok {
+		return nil
+	}
+	return pf.Prefetch(ctx, files)
+}
@@ -0,0 +1,236 @@
+package sandwich
+
+import (
+	"github.com/n0h0/git-sandwich/internal/diff"
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// Result is the outcome of a validation. It marshals to the JSON that
+// --json prints.
+type Result struct {
+	Success bool `json:"success"`
+	// Commits lists every commit walked in per-commit mode, including
+	// skipped merges.
+	Commits []string     `json:"commits,omitempty"`
+	Files   []FileResult `json:"files"`
+}
+
+// FileResult is the outcome of validating one file against one rule.
+type FileResult struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	// Commit is the commit the file was changed in, in per-commit mode.
+	Commit string `json:"commit,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+	Mode   Mode   `json:"mode,omitempty"`
+	// Success is false if the file violates its rule.
+	Success bool `json:"success"`
+	// OutsideBase and OutsideHead are the changed lines outside blocks,
+	// and ProtectedBase and ProtectedHead the changed lines inside blocks
+	// in protect mode, on each side.
+	OutsideBase   []LineRange `json:"outside_base,omitempty"`
+	OutsideHead   []LineRange `json:"outside_head,omitempty"`
+	ProtectedBase []LineRange `json:"protected_base,omitempty"`
+	ProtectedHead []LineRange `json:"protected_head,omitempty"`
+	// BoundaryChanged is true if block markers changed.
+	BoundaryChanged bool          `json:"boundary_changed,omitempty"`
+	BlockChanges    []BlockChange `json:"block_changes,omitempty"`
+	BlockErrors     []BlockError  `json:"block_errors,omitempty"`
+	// PolicyError is set if a protected path changed.
+	PolicyError string `json:"policy_error,omitempty"`
+	// SkipReason is set if the file was not validated, and why.
+	SkipReason string    `json:"skip_reason,omitempty"`
+	Snippets   []Snippet `json:"snippets,omitempty"`
+	// RangeBlocks names the blocks of the violating ranges above.
+	RangeBlocks []RangeBlock `json:"range_blocks,omitempty"`
+
+	// Hunks are the changes from base to head, used to map base line
+	// numbers to head line numbers. Nil if no diff was involved.
+	Hunks []Hunk `json:"-"`
+}
+
+// LineRange is a range of lines, 1-indexed and inclusive.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// RangeBlock names the block a violating range of lines is in or, for a
+// range outside blocks, the block nearest to it. Side is "base" or "head".
+// Ranges whose block is unnamed have no RangeBlock.
+type RangeBlock struct {
+	Side  string    `json:"side"`
+	Lines LineRange `json:"lines"`
+	Name  string    `json:"name"`
+}
+
+// Hunk is a change from base to head, used to map line numbers between them.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+// Snippet is an excerpt of one violating hunk, together with the nearest
+// block markers before and after it.
+type Snippet struct {
+	Lines []SnippetLine `json:"lines"`
+}
+
+// SnippetLine is a line of a snippet. Kind is "-" for a line that only exists
+// in the base, "+" for a line that only exists in the head and " " for an
+// unchanged marker line. The line number on the side a line does not exist
+// in is 0.
+type SnippetLine struct {
+	Kind     string `json:"kind"`
+	BaseLine int    `json:"base_line,omitempty"`
+	HeadLine int    `json:"head_line,omitempty"`
+	Text     string `json:"text"`
+}
+
+// BlockChange is a block-level change between base and head. Base and Head
+// are the marker lines of the block on each side; one of them is nil for
+// added and deleted blocks.
+type BlockChange struct {
+	Kind    BlockChangeKind `json:"kind"`
+	Name    string          `json:"name,omitempty"`
+	OldName string          `json:"old_name,omitempty"`
+	Base    *LineRange      `json:"base,omitempty"`
+	Head    *LineRange      `json:"head,omitempty"`
+	// Denied is true if the rule denies changes of this kind.
+	Denied bool `json:"denied,omitempty"`
+}
+
+// BlockChangeKind describes how a block differs between base and head.
+type BlockChangeKind string
+
+const (
+	BlockAdded   BlockChangeKind = "added"
+	BlockDeleted BlockChangeKind = "deleted"
+	BlockRenamed BlockChangeKind = "renamed"
+	BlockMoved   BlockChangeKind = "moved"
+	BlockResized BlockChangeKind = "resized"
+)
+
+// BlockError is a problem with the block structure of a file, or a file that
+// could not be read. Line is the marker line the error refers to. For name
+// mismatches, Name is the END marker's name and BeginName and BeginLine
+// describe the open block. Side tells which version of the file the error
+// was found in: "base" or "head".
+type BlockError struct {
+	Kind      BlockErrorKind `json:"kind"`
+	Side      string         `json:"side,omitempty"`
+	Line      int            `json:"line,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	BeginName string         `json:"begin_name,omitempty"`
+	BeginLine int            `json:"begin_line,omitempty"`
+	Message   string         `json:"message"`
+}
+
+func (e *BlockError) Error() string {
+	if e.Side != "" {
+		return e.Side + ": " + e.Message
+	}
+	return e.Message
+}
+
+// BlockErrorKind identifies the kind of a BlockError.
+type BlockErrorKind string
+
+const (
+	// ErrUnmatchedEnd is an END marker with no open block.
+	ErrUnmatchedEnd BlockErrorKind = "unmatched_end"
+	// ErrUnclosedBegin is a BEGIN marker that is never closed.
+	ErrUnclosedBegin BlockErrorKind = "unclosed_begin"
+	// ErrNestedBegin is a BEGIN marker inside a block when nesting is not allowed.
+	ErrNestedBegin BlockErrorKind = "nested_begin"
+	// ErrNameMismatch is an END marker whose name differs from the open block's.
+	ErrNameMismatch BlockErrorKind = "name_mismatch"
+	// ErrRead means the file could not be read, so its blocks are unknown.
+	ErrRead BlockErrorKind = "read"
+)
+
+// newResult converts a result of the validator.
+func newResult(r *sandwich.Result) *Result {
+	result := &Result{Success: r.Success, Commits: r.Commits}
+	if r.Files != nil {
+		result.Files = make([]FileResult, 0, len(r.Files))
+	}
+	for _, fr := range r.Files {
+		result.Files = append(result.Files, newFileResult(fr))
+	}
+	return result
+}
+
+func newFileResult(fr sandwich.FileResult) FileResult {
+	result := FileResult{
+		Path:            fr.Path,
+		OldPath:         fr.OldPath,
+		Commit:          fr.Commit,
+		Rule:            fr.Rule,
+		Mode:            Mode(fr.Mode),
+		Success:         fr.Success,
+		OutsideBase:     newLineRanges(fr.OutsideBase),
+		OutsideHead:     newLineRanges(fr.OutsideHead),
+		ProtectedBase:   newLineRanges(fr.ProtectedBase),
+		ProtectedHead:   newLineRanges(fr.ProtectedHead),
+		BoundaryChanged: fr.BoundaryChanged,
+		PolicyError:     fr.PolicyError,
+		SkipReason:      fr.SkipReason,
+	}
+	for _, c := range fr.BlockChanges {
+		result.BlockChanges = append(result.BlockChanges, BlockChange{
+			Kind:    BlockChangeKind(c.Kind),
+			Name:    c.Name,
+			OldName: c.OldName,
+			Base:    newLineRange(c.Base),
+			Head:    newLineRange(c.Head),
+			Denied:  c.Denied,
+		})
+	}
+	for _, e := range fr.BlockErrors {
+		result.BlockErrors = append(result.BlockErrors, BlockError{
+			Kind:      BlockErrorKind(e.Kind),
+			Side:      e.Side,
+			Line:      e.Line,
+			Name:      e.Name,
+			BeginName: e.BeginName,
+			BeginLine: e.BeginLine,
+			Message:   e.Message,
+		})
+	}
+	for _, s := range fr.Snippets {
+		var snippet Snippet
+		if s.Lines != nil {
+			snippet.Lines = make([]SnippetLine, 0, len(s.Lines))
+		}
+		for _, l := range s.Lines {
+			snippet.Lines = append(snippet.Lines, SnippetLine(l))
+		}
+		result.Snippets = append(result.Snippets, snippet)
+	}
+	for _, b := range fr.RangeBlocks {
+		result.RangeBlocks = append(result.RangeBlocks, RangeBlock{Side: b.Side, Lines: LineRange(b.Lines), Name: b.Name})
+	}
+	for _, h := range fr.Hunks {
+		result.Hunks = append(result.Hunks, Hunk(h))
+	}
+	return result
+}
+
+func newLineRanges(ranges []diff.LineRange) []LineRange {
+	var result []LineRange
+	for _, r := range ranges {
+		result = append(result, LineRange(r))
+	}
+	return result
+}
+
+func newLineRange(r *diff.LineRange) *LineRange {
+	if r == nil {
+		return nil
+	}
+	lr := LineRange(*r)
+	return &lr
+}
@@ -0,0 +1,187 @@
+// Package sandwich validates that the changes between two revisions of a Git
+// repository are confined to BEGIN/END blocks, or, in protect mode, kept out
+// of them. It is the library behind the git-sandwich command.
+//
+// Validate reads diffs and file contents through a DiffProvider and a
+// ContentProvider. By default both run the git command in the current
+// directory; Git offers the other backends of the command, and callers may
+// plug in their own.
+package sandwich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// Options configure Validate.
+type Options struct {
+	// BaseRef and HeadRef are the revisions to compare. The changes from
+	// their merge base to HeadRef are validated. HeadRef may be StagedRef or
+	// WorktreeRef.
+	BaseRef string
+	HeadRef string
+	// Rules are the block markers and flags files are validated against.
+	// At least one is required.
+	Rules []Rule
+	// Paths limit the diff to these paths, if any are given.
+	Paths []string
+	// IncludePatterns and ExcludePatterns are glob patterns that select the
+	// files to validate, like the --include and --exclude flags.
+	IncludePatterns []string
+	ExcludePatterns []string
+	// ProtectedPaths are repository-relative paths that must not change at
+	// all.
+	ProtectedPaths []string
+	// PerCommit validates each commit in BaseRef..HeadRef against its
+	// parents instead of the combined diff. The commits are listed from the
+	// repository, so Diff and Content must be nil or a Git.
+	PerCommit   bool
+	MergePolicy MergePolicy
+	// Snippets attaches excerpts of the violating hunks to failed results.
+	Snippets bool
+	// Jobs is the number of files validated in parallel. Zero means one per
+	// CPU.
+	Jobs int
+	// Diff and Content provide the diffs and file contents. Nil means the
+	// git command is run for each of them.
+	Diff    DiffProvider
+	Content ContentProvider
+}
+
+// Validate validates the changes described by opts. Providers receive ctx
+// with every request; once ctx is done, no more files are validated and
+// Validate returns the context's error.
+//
+// A non-nil error means validation could not be completed. Violations are
+// reported in the Result, whose Success field is false if there are any.
+func Validate(ctx context.Context, opts Options) (*Result, error) {
+	if opts.BaseRef == "" || opts.HeadRef == "" {
+		return nil, errors.New("base and head refs are required")
+	}
+	if len(opts.Rules) == 0 {
+		return nil, errors.New("at least one rule is required")
+	}
+	for i, r := range opts.Rules {
+		if r.StartMarkerRegex == nil || r.EndMarkerRegex == nil {
+			return nil, fmt.Errorf("rules[%d]: start and end markers are required", i)
+		}
+	}
+	switch opts.MergePolicy {
+	case "", MergeSkip, MergeFirstParent, MergeAllParents:
+	default:
+		return nil, fmt.Errorf("unknown merge policy %q", opts.MergePolicy)
+	}
+	if opts.Jobs < 0 {
+		return nil, fmt.Errorf("invalid jobs value %d (want 0 or more)", opts.Jobs)
+	}
+	if opts.PerCommit && (!isGit(opts.Diff) || !isGit(opts.Content)) {
+		return nil, errors.New("per-commit validation requires Git providers")
+	}
+
+	cfg := &sandwich.Config{
+		BaseRef:         opts.BaseRef,
+		HeadRef:         opts.HeadRef,
+		Paths:           opts.Paths,
+		IncludePatterns: opts.IncludePatterns,
+		ExcludePatterns: opts.ExcludePatterns,
+		PerCommit:       opts.PerCommit,
+		MergePolicy:     sandwich.MergePolicy(opts.MergePolicy),
+		ProtectedPaths:  opts.ProtectedPaths,
+		Rules:           internalRules(opts.Rules),
+		Snippets:        opts.Snippets,
+		Repository:      repository(opts.Diff, opts.Content),
+		Jobs:            opts.Jobs,
+	}
+	if cfg.MergePolicy == "" {
+		cfg.MergePolicy = sandwich.MergeSkip
+	}
+	result, err := sandwich.Validate(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(result), nil
+}
+
+// isGit reports whether a provider is nil, which stands for the git command,
+// or a Git.
+func isGit(provider any) bool {
+	if provider == nil {
+		return true
+	}
+	_, ok := provider.(*Git)
+	return ok
+}
+
+// Rule is a named set of block markers and flags. A file is validated against
+// every rule whose include and exclude patterns match its path. The name may
+// be empty.
+type Rule struct {
+	Name string
+	// StartMarkerRegex and EndMarkerRegex match the BEGIN and END markers.
+	// A "name" capture group in StartMarkerRegex names the block.
+	StartMarkerRegex *regexp.Regexp
+	EndMarkerRegex   *regexp.Regexp
+	// AllowNesting allows blocks inside blocks.
+	AllowNesting bool
+	// AllowBoundaryWithOutside accepts changes outside blocks if markers
+	// changed as well.
+	AllowBoundaryWithOutside bool
+	Mode                     Mode
+	// DenyBlockChanges fails files with block changes of these kinds.
+	DenyBlockChanges []BlockChangeKind
+	// IncludePatterns and ExcludePatterns select the files the rule
+	// applies to. No patterns means every file.
+	IncludePatterns []string
+	ExcludePatterns []string
+}
+
+// Mode determines which side of the block markers may be edited.
+type Mode string
+
+const (
+	// ModeAllow allows changes inside blocks and rejects changes outside
+	// them. The zero value is treated as ModeAllow.
+	ModeAllow Mode = "allow"
+	// ModeProtect rejects changes inside blocks, including the markers
+	// themselves, and allows changes outside them.
+	ModeProtect Mode = "protect"
+)
+
+// MergePolicy controls how merge commits are validated in per-commit mode.
+type MergePolicy string
+
+const (
+	// MergeSkip skips merge commits entirely. It is the default.
+	MergeSkip MergePolicy = "skip"
+	// MergeFirstParent validates a merge commit against its first parent only.
+	MergeFirstParent MergePolicy = "first-parent"
+	// MergeAllParents validates a merge commit against each of its parents.
+	MergeAllParents MergePolicy = "all-parents"
+)
+
+// internalRules converts rules to the validator's.
+func internalRules(rules []Rule) []sandwich.Rule {
+	result := make([]sandwich.Rule, len(rules))
+	for i, r := range rules {
+		var deny []sandwich.BlockChangeKind
+		for _, kind := range r.DenyBlockChanges {
+			deny = append(deny, sandwich.BlockChangeKind(kind))
+		}
+		result[i] = sandwich.Rule{
+			Name:                     r.Name,
+			StartMarkerRegex:         r.StartMarkerRegex,
+			EndMarkerRegex:           r.EndMarkerRegex,
+			AllowNesting:             r.AllowNesting,
+			AllowBoundaryWithOutside: r.AllowBoundaryWithOutside,
+			Mode:                     sandwich.Mode(r.Mode),
+			DenyBlockChanges:         deny,
+			IncludePatterns:          r.IncludePatterns,
+			ExcludePatterns:          r.ExcludePatterns,
+		}
+	}
+	return result
+}
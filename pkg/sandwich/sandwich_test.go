@@ -0,0 +1,256 @@
+package sandwich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/n0h0/git-sandwich/internal/sandwich"
+)
+
+// memRepo provides a fixed diff and file contents from memory.
+type memRepo struct {
+	diff  string
+	files map[string]string // "ref:path" -> content
+	reads atomic.Int32
+	// onRead is called with every file read, if set.
+	onRead func()
+}
+
+func (m *memRepo) Diff(ctx context.Context, baseRef, headRef string, paths []string) ([]byte, error) {
+	return []byte(m.diff), nil
+}
+
+func (m *memRepo) FileContent(ctx context.Context, ref, path string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	m.reads.Add(1)
+	if m.onRead != nil {
+		m.onRead()
+	}
+	content, ok := m.files[ref+":"+path]
+	return content, ok, nil
+}
+
+func fileDiff(path string, oldLine, newLine int, oldText, newText string) string {
+	return fmt.Sprintf("diff --git a/%s b/%s\nindex 1111111..2222222 100644\n--- a/%s\n+++ b/%s\n@@ -%d +%d @@\n-%s\n+%s\n",
+		path, path, path, path, oldLine, newLine, oldText, newText)
+}
+
+func testRules() []Rule {
+	return []Rule{{
+		StartMarkerRegex: regexp.MustCompile(`# BEGIN`),
+		EndMarkerRegex:   regexp.MustCompile(`# END`),
+	}}
+}
+
+const baseContent = "line 1\n# BEGIN\nold\n# END\nline 5\n"
+
+func TestValidate_Providers(t *testing.T) {
+	repo := &memRepo{
+		diff: fileDiff("inside.rb", 3, 3, "old", "new") + fileDiff("outside.rb", 5, 5, "line 5", "changed"),
+		files: map[string]string{
+			"base:inside.rb":  baseContent,
+			"head:inside.rb":  strings.Replace(baseContent, "old", "new", 1),
+			"base:outside.rb": baseContent,
+			"head:outside.rb": strings.Replace(baseContent, "line 5", "changed", 1),
+		},
+	}
+	result, err := Validate(context.Background(), Options{
+		BaseRef: "base",
+		HeadRef: "head",
+		Rules:   testRules(),
+		Diff:    repo,
+		Content: repo,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success {
+		t.Error("expected failure")
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("expected 2 file results, got %+v", result.Files)
+	}
+	if fr := result.Files[0]; fr.Path != "inside.rb" || !fr.Success {
+		t.Errorf("expected inside.rb to pass, got %+v", fr)
+	}
+	want := []LineRange{{Start: 5, End: 5}}
+	if fr := result.Files[1]; fr.Path != "outside.rb" || fr.Success || len(fr.OutsideHead) != 1 || fr.OutsideHead[0] != want[0] {
+		t.Errorf("expected outside.rb to fail at line 5, got %+v", fr)
+	}
+}
+
+func TestValidate_ResultJSON(t *testing.T) {
+	rawDiff := func(path, hunk string) string {
+		return fmt.Sprintf("diff --git a/%s b/%s\nindex 1111111..2222222 100644\n--- a/%s\n+++ b/%s\n%s", path, path, path, path, hunk)
+	}
+	repo := &memRepo{
+		diff: fileDiff("outside.rb", 5, 5, "line 5", "changed") +
+			rawDiff("resized.rb", "@@ -3,0 +4 @@\n+extra\n") +
+			rawDiff("broken.rb", "@@ -4 +3,0 @@\n-# END\n"),
+		files: map[string]string{
+			"base:outside.rb": baseContent,
+			"head:outside.rb": strings.Replace(baseContent, "line 5", "changed", 1),
+			"base:resized.rb": baseContent,
+			"head:resized.rb": strings.Replace(baseContent, "old\n", "old\nextra\n", 1),
+			"base:broken.rb":  baseContent,
+			"head:broken.rb":  strings.Replace(baseContent, "# END\n", "", 1),
+		},
+	}
+	rules := testRules()
+	rules[0].DenyBlockChanges = []BlockChangeKind{BlockResized}
+	opts := Options{BaseRef: "base", HeadRef: "head", Rules: rules, Snippets: true, Diff: repo, Content: repo}
+	result, err := Validate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	internalResult, err := sandwich.Validate(context.Background(), &sandwich.Config{
+		BaseRef:     "base",
+		HeadRef:     "head",
+		Rules:       internalRules(rules),
+		Snippets:    true,
+		MergePolicy: sandwich.MergeSkip,
+		Repository:  repository(repo, repo),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, _ := json.Marshal(result)
+	want, _ := json.Marshal(internalResult)
+	if string(got) != string(want) {
+		t.Errorf("expected the JSON of the validator\n%s\ngot\n%s", want, got)
+	}
+	for _, kind := range []string{`"outside_head"`, `"snippets"`, `"denied":true`, `"block_errors"`} {
+		if !strings.Contains(string(got), kind) {
+			t.Errorf("expected %s in %s", kind, got)
+		}
+	}
+}
+
+func TestValidate_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"no refs", Options{Rules: testRules()}},
+		{"no rules", Options{BaseRef: "base", HeadRef: "head"}},
+		{"no markers", Options{BaseRef: "base", HeadRef: "head", Rules: []Rule{{Name: "empty"}}}},
+		{"merge policy", Options{BaseRef: "base", HeadRef: "head", Rules: testRules(), MergePolicy: "octopus"}},
+		{"jobs", Options{BaseRef: "base", HeadRef: "head", Rules: testRules(), Jobs: -1}},
+		{"per-commit providers", Options{BaseRef: "base", HeadRef: "head", Rules: testRules(), PerCommit: true, Diff: &memRepo{}}},
+	}
+	for _, tt := range tests {
+		if _, err := Validate(context.Background(), tt.opts); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestValidate_Canceled(t *testing.T) {
+	repo := &memRepo{files: map[string]string{}}
+	for i := range 50 {
+		path := fmt.Sprintf("file%02d.rb", i)
+		repo.diff += fileDiff(path, 3, 3, "old", "new")
+		repo.files["base:"+path] = baseContent
+		repo.files["head:"+path] = strings.Replace(baseContent, "old", "new", 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Validate(ctx, Options{BaseRef: "base", HeadRef: "head", Rules: testRules(), Diff: repo, Content: repo}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if n := repo.reads.Load(); n != 0 {
+		t.Errorf("expected no reads, got %d", n)
+	}
+
+	// Cancel while the files are validated
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	repo.onRead = cancel
+	_, err := Validate(ctx, Options{BaseRef: "base", HeadRef: "head", Rules: testRules(), Diff: repo, Content: repo, Jobs: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if n := repo.reads.Load(); n >= 100 {
+		t.Errorf("expected validation to stop early, got %d reads", n)
+	}
+}
+
+func TestValidate_Git(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-b", "main")
+	git("config", "user.email", "test@test.com")
+	git("config", "user.name", "Test")
+	if err := os.WriteFile(filepath.Join(dir, "app.rb"), []byte(baseContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "-A")
+	git("commit", "-m", "base")
+	git("checkout", "-b", "feature")
+	if err := os.WriteFile(filepath.Join(dir, "app.rb"), []byte(strings.Replace(baseContent, "line 5", "changed", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	origDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(origDir) })
+
+	git("commit", "-am", "change")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, backend := range []string{"", BackendExec, BackendBatch, BackendGoGit} {
+		opts := Options{BaseRef: "main", HeadRef: "HEAD", Rules: testRules()}
+		if backend != "" {
+			g, err := NewGit(backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+			opts.Diff, opts.Content = g, g
+
+			if _, err := g.Diff(canceled, "main", "HEAD", nil); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: expected Diff to fail with context.Canceled, got %v", backend, err)
+			}
+			if _, _, err := g.FileContent(canceled, "main", "app.rb"); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: expected FileContent to fail with context.Canceled, got %v", backend, err)
+			}
+		}
+		for _, perCommit := range []bool{false, true} {
+			opts.PerCommit = perCommit
+			result, err := Validate(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", backend, err)
+			}
+			if result.Success || len(result.Files) != 1 || len(result.Files[0].OutsideHead) != 1 {
+				t.Errorf("%s (per-commit %v): expected app.rb to fail, got %+v", backend, perCommit, result)
+			}
+		}
+	}
+
+	if _, err := NewGit("svn"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}